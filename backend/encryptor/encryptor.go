@@ -0,0 +1,323 @@
+package encryptor
+
+import (
+	"beanckup/backend/types"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// Suffix 原生加密的交付包在归档文件名后追加的后缀，例如 <名称>.zip.enc
+	Suffix = ".enc"
+
+	// Algorithm 数据加密算法
+	Algorithm = "XChaCha20-Poly1305"
+
+	kdfAlgorithm = "argon2id"
+	saltSize     = 16
+
+	// Argon2id 默认参数：3 轮、64MiB 内存、4 线程
+	defaultTime    = 3
+	defaultMemory  = 64 * 1024
+	defaultThreads = 4
+
+	// 解密时接受的参数上限，防止被篡改的头部要求过大的内存或计算量
+	maxTime    = 16
+	maxMemory  = 2 * 1024 * 1024
+	maxThreads = 64
+)
+
+// Key 由密码派生的密钥加密密钥（KEK），只用于封装每个文件随机生成的数据加密密钥（DEK）
+type Key struct {
+	kek []byte
+	id  string
+	kdf types.KDFParams
+}
+
+// NewKDFParams 返回使用随机盐与默认参数的 Argon2id 派生参数
+func NewKDFParams() (types.KDFParams, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return types.KDFParams{}, fmt.Errorf("生成随机盐失败: %w", err)
+	}
+	return types.KDFParams{
+		Algorithm: kdfAlgorithm,
+		Salt:      salt,
+		Time:      defaultTime,
+		Memory:    defaultMemory,
+		Threads:   defaultThreads,
+	}, nil
+}
+
+// DeriveKey 按派生参数由密码计算 KEK
+func DeriveKey(password []byte, params types.KDFParams) (*Key, error) {
+	if params.Algorithm != kdfAlgorithm || len(params.Salt) == 0 ||
+		params.Time == 0 || params.Time > maxTime ||
+		params.Memory == 0 || params.Memory > maxMemory ||
+		params.Threads == 0 || params.Threads > maxThreads {
+		return nil, fmt.Errorf("%w: 密钥派生参数 %s t=%d m=%d p=%d", ErrUnsupportedFormat, params.Algorithm, params.Time, params.Memory, params.Threads)
+	}
+	kek := argon2.IDKey(password, params.Salt, params.Time, params.Memory, params.Threads, chacha20poly1305.KeySize)
+	hasher := sha256.New()
+	hasher.Write([]byte("beanckup-kek-id:"))
+	hasher.Write(kek)
+	return &Key{kek: kek, id: hex.EncodeToString(hasher.Sum(nil)[:8]), kdf: params}, nil
+}
+
+// ID 返回 KEK 的标识（KEK 的 SHA-256 前 8 字节），不能由标识反推出密钥
+func (k *Key) ID() string {
+	return k.id
+}
+
+// verifierCheck 返回以 KEK 计算的密码校验值
+func (k *Key) verifierCheck() string {
+	mac := hmac.New(sha256.New, k.kek)
+	mac.Write([]byte("beanckup password verifier"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Wipe 清零密钥材料
+func (k *Key) Wipe() {
+	clear(k.kek)
+}
+
+// KeySources 除密码外的密钥来源
+type KeySources struct {
+	Keyfiles   []*Keyfile   // 密钥文件，加密与解密都使用
+	Identities []*Identity  // X25519 私钥，只用于解密
+	Recipients []*PublicKey // X25519 接收者公钥，只用于加密
+}
+
+// empty 判断是否没有任何密钥来源
+func (s KeySources) empty() bool {
+	return len(s.Keyfiles) == 0 && len(s.Identities) == 0 && len(s.Recipients) == 0
+}
+
+// Keyring 持有一次操作使用的密码、密钥文件与私钥，以及由密码派生的密钥
+// 密码只以字节切片保存在内存中，操作结束后调用 Wipe 清零；nil 表示没有提供任何密钥
+type Keyring struct {
+	mu       sync.Mutex
+	password []byte
+	sources  KeySources
+	derived  map[string]*Key // 按盐缓存已派生的 KEK，同一次运行的交付包共用一次派生
+	sealing  *Key
+}
+
+// NewKeyring 创建密钥环，既没有密码也没有其他密钥来源时返回 nil
+func NewKeyring(password string, sources KeySources) *Keyring {
+	if password == "" && sources.empty() {
+		return nil
+	}
+	return &Keyring{password: []byte(password), sources: sources, derived: make(map[string]*Key)}
+}
+
+// Password 返回密码的副本，供只能接受密码的外部程序（7zr）使用；调用方用完后应将其清零
+func (k *Keyring) Password() []byte {
+	if k == nil {
+		return nil
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return bytes.Clone(k.password)
+}
+
+// HasPassword 判断密钥环中是否有密码
+func (k *Keyring) HasPassword() bool {
+	return k != nil && len(k.password) > 0
+}
+
+// CanSeal 判断密钥环中是否有可用于加密的接收者（密码、密钥文件或公钥）
+func (k *Keyring) CanSeal() bool {
+	return k != nil && (len(k.password) > 0 || len(k.sources.Keyfiles) > 0 || len(k.sources.Recipients) > 0)
+}
+
+// Recipients 返回加密时的全部接收者：密码（首次调用时以新的随机盐派生 KEK，之后复用）、密钥文件与公钥
+func (k *Keyring) Recipients() ([]Recipient, error) {
+	if !k.CanSeal() {
+		return nil, ErrNoRecipients
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var recipients []Recipient
+	if len(k.password) > 0 {
+		if k.sealing == nil {
+			params, err := NewKDFParams()
+			if err != nil {
+				return nil, err
+			}
+			key, err := DeriveKey(k.password, params)
+			if err != nil {
+				return nil, err
+			}
+			k.sealing = key
+			k.derived[hex.EncodeToString(params.Salt)] = key
+		}
+		recipients = append(recipients, k.sealing)
+	}
+	for _, keyfile := range k.sources.Keyfiles {
+		recipients = append(recipients, keyfile)
+	}
+	for _, publicKey := range k.sources.Recipients {
+		recipients = append(recipients, publicKey)
+	}
+	return recipients, nil
+}
+
+// unwrap 依次尝试用密码、密钥文件与私钥解开头部中封装的 DEK
+func (k *Keyring) unwrap(stanzas []*stanza) ([]byte, error) {
+	if k == nil {
+		return nil, ErrPasswordRequired
+	}
+	for _, s := range stanzas {
+		ad := []byte(s.Type + ":" + s.KeyID)
+		switch s.Type {
+		case RecipientPassword:
+			if len(k.password) == 0 || s.KDF == nil {
+				continue
+			}
+			key, err := k.key(*s.KDF, s.KeyID)
+			if errors.Is(err, ErrWrongPassword) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if dek, err := unwrapKey(key.kek, s.WrappedKey, ad); err == nil {
+				return dek, nil
+			}
+		case RecipientKeyfile:
+			for _, keyfile := range k.sources.Keyfiles {
+				if keyfile.id != s.KeyID {
+					continue
+				}
+				if dek, err := keyfile.unwrap(s); err == nil {
+					return dek, nil
+				}
+			}
+		case RecipientX25519:
+			for _, identity := range k.sources.Identities {
+				if identity.Recipient().id != s.KeyID {
+					continue
+				}
+				if dek, err := identity.unwrap(s); err == nil {
+					return dek, nil
+				}
+			}
+		}
+	}
+	return nil, ErrWrongPassword
+}
+
+// key 返回按指定参数由密码派生的 KEK，并确认其标识与加密时记录的一致
+func (k *Keyring) key(params types.KDFParams, keyID string) (*Key, error) {
+	key, err := k.derive(params)
+	if err != nil {
+		return nil, err
+	}
+	if key.id != keyID {
+		return nil, ErrWrongPassword
+	}
+	return key, nil
+}
+
+// derive 返回按指定参数由密码派生的 KEK，同一组参数只派生一次
+func (k *Keyring) derive(params types.KDFParams) (*Key, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	cacheKey := hex.EncodeToString(params.Salt)
+	key, ok := k.derived[cacheKey]
+	if !ok || key.kdf.Time != params.Time || key.kdf.Memory != params.Memory || key.kdf.Threads != params.Threads {
+		derived, err := DeriveKey(k.password, params)
+		if err != nil {
+			return nil, err
+		}
+		key = derived
+		k.derived[cacheKey] = key
+	}
+	return key, nil
+}
+
+// NewVerifier 以新的随机盐由密码派生校验值；密钥环中没有密码时返回 nil
+func (k *Keyring) NewVerifier() (*types.PasswordVerifier, error) {
+	if !k.HasPassword() {
+		return nil, nil
+	}
+	params, err := NewKDFParams()
+	if err != nil {
+		return nil, err
+	}
+	key, err := k.derive(params)
+	if err != nil {
+		return nil, err
+	}
+	return &types.PasswordVerifier{KDF: params, Check: key.verifierCheck()}, nil
+}
+
+// CheckPassword 按校验值确认密钥环中的密码；没有密码时返回 ErrPasswordRequired，不一致时返回 ErrPasswordMismatch
+func (k *Keyring) CheckPassword(verifier *types.PasswordVerifier) error {
+	if !k.HasPassword() {
+		return ErrPasswordRequired
+	}
+	key, err := k.derive(verifier.KDF)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(key.verifierCheck()), []byte(verifier.Check)) {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+// CheckRecipient 按加密时记录的密码接收者（KDF 参数与 KEK 标识）确认密钥环中的密码，用于还没有校验值的系列
+func (k *Keyring) CheckRecipient(recipient types.RecipientInfo) error {
+	if !k.HasPassword() {
+		return ErrPasswordRequired
+	}
+	if recipient.Type != RecipientPassword || recipient.KDF == nil {
+		return fmt.Errorf("%w: 接收者类型 %s", ErrUnsupportedFormat, recipient.Type)
+	}
+	if _, err := k.key(*recipient.KDF, recipient.KeyID); err != nil {
+		if errors.Is(err, ErrWrongPassword) {
+			return ErrPasswordMismatch
+		}
+		return err
+	}
+	return nil
+}
+
+// Wipe 清零密码与所有派生的密钥；密钥文件与私钥由加载它们的一方管理
+func (k *Keyring) Wipe() {
+	if k == nil {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	clear(k.password)
+	for _, key := range k.derived {
+		key.Wipe()
+	}
+	k.derived = make(map[string]*Key)
+	k.sealing = nil
+}
+
+// Info 返回以指定接收者加密的数据的加密信息
+func Info(recipients []Recipient) *types.EncryptionInfo {
+	info := &types.EncryptionInfo{
+		Mode:      types.EncryptionNative,
+		Algorithm: Algorithm,
+		ChunkSize: chunkSize,
+	}
+	for _, recipient := range recipients {
+		info.Recipients = append(info.Recipients, recipient.info())
+	}
+	return info
+}
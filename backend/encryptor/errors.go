@@ -0,0 +1,32 @@
+package encryptor
+
+import "errors"
+
+var (
+	// ErrPasswordRequired 数据已加密，需要密码
+	ErrPasswordRequired = errors.New("数据已加密，需要提供密码")
+
+	// ErrWrongPassword 密码错误
+	ErrWrongPassword = errors.New("密码错误或密钥不匹配")
+
+	// ErrNotEncrypted 数据未经原生加密层加密
+	ErrNotEncrypted = errors.New("数据未加密")
+
+	// ErrUnsupportedFormat 不支持的加密格式或参数
+	ErrUnsupportedFormat = errors.New("不支持的加密格式")
+
+	// ErrCorrupted 密文已损坏或被篡改
+	ErrCorrupted = errors.New("密文已损坏或被篡改")
+
+	// ErrNoRecipients 没有可用于加密的密码、密钥文件或公钥
+	ErrNoRecipients = errors.New("没有可用于加密的密码、密钥文件或公钥")
+
+	// ErrInvalidKey 密钥文件或公钥无效
+	ErrInvalidKey = errors.New("密钥无效")
+
+	// ErrPasswordMismatch 密码与系列的校验值不一致
+	ErrPasswordMismatch = errors.New("密码与系列之前使用的密码不一致")
+
+	// ErrKeyExists 密钥文件已存在
+	ErrKeyExists = errors.New("密钥文件已存在，拒绝覆盖")
+)
@@ -0,0 +1,345 @@
+package encryptor
+
+import (
+	"beanckup/backend/types"
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// 接收者类型
+const (
+	RecipientPassword = "password" // 由密码经 Argon2id 派生的 KEK
+	RecipientKeyfile  = "keyfile"  // 由密钥文件内容派生的 KEK
+	RecipientX25519   = "x25519"   // X25519 公钥，持有对应私钥的一方可以解密
+)
+
+const (
+	publicKeyPrefix  = "beanckup-pub-"
+	identityPrefix   = "BEANCKUP-SECRET-KEY-"
+	keyfileHeader    = "# beanckup keyfile"
+	maxKeyfileSize   = 1 << 20
+	keyfileSaltSize  = 16
+	generatedKeySize = 32
+)
+
+// stanza 加密头部中为一个接收者封装的 DEK
+type stanza struct {
+	Type       string           `json:"type"`
+	KeyID      string           `json:"keyId"`
+	KDF        *types.KDFParams `json:"kdf,omitempty"`       // 密码接收者的派生参数
+	Salt       []byte           `json:"salt,omitempty"`      // 密钥文件接收者的派生盐
+	Ephemeral  []byte           `json:"ephemeral,omitempty"` // X25519 接收者的临时公钥
+	WrappedKey []byte           `json:"wrappedKey"`          // 随机数 | 被封装的 DEK
+}
+
+// Recipient 加密时的接收者，为每个文件的 DEK 生成一个封装
+type Recipient interface {
+	wrap(dek []byte) (*stanza, error)
+	info() types.RecipientInfo
+}
+
+// wrapKey 用 kek 封装 dek，附加数据绑定接收者类型与标识
+func wrapKey(kek, dek []byte, recipientType, keyID string) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(kek)
+	if err != nil {
+		return nil, fmt.Errorf("初始化密钥失败: %w", err)
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("生成随机数失败: %w", err)
+	}
+	return aead.Seal(nonce, nonce, dek, []byte(recipientType+":"+keyID)), nil
+}
+
+// unwrapKey 用 kek 解开封装的 dek，失败说明密钥不匹配或封装被篡改
+func unwrapKey(kek, wrapped []byte, ad []byte) ([]byte, error) {
+	if len(wrapped) < chacha20poly1305.NonceSizeX {
+		return nil, fmt.Errorf("%w: 数据加密密钥缺失", ErrCorrupted)
+	}
+	aead, err := chacha20poly1305.NewX(kek)
+	if err != nil {
+		return nil, fmt.Errorf("初始化密钥失败: %w", err)
+	}
+	dek, err := aead.Open(nil, wrapped[:chacha20poly1305.NonceSizeX], wrapped[chacha20poly1305.NonceSizeX:], ad)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	return dek, nil
+}
+
+// deriveWrappingKey 以 HKDF-SHA256 派生封装 DEK 使用的密钥
+func deriveWrappingKey(secret, salt []byte, label string) ([]byte, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(label)), key); err != nil {
+		return nil, fmt.Errorf("派生密钥失败: %w", err)
+	}
+	return key, nil
+}
+
+// shortID 返回带标签的 SHA-256 前 8 字节，用作密钥标识
+func shortID(label string, data []byte) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(label))
+	hasher.Write(data)
+	return hex.EncodeToString(hasher.Sum(nil)[:8])
+}
+
+// wrap 以密码派生的 KEK 封装 DEK
+func (k *Key) wrap(dek []byte) (*stanza, error) {
+	wrapped, err := wrapKey(k.kek, dek, RecipientPassword, k.id)
+	if err != nil {
+		return nil, err
+	}
+	kdf := k.kdf
+	return &stanza{Type: RecipientPassword, KeyID: k.id, KDF: &kdf, WrappedKey: wrapped}, nil
+}
+
+// info 返回密码接收者的描述
+func (k *Key) info() types.RecipientInfo {
+	kdf := k.kdf
+	return types.RecipientInfo{Type: RecipientPassword, KeyID: k.id, KDF: &kdf}
+}
+
+// Keyfile 密钥文件：任意内容的文件，以其 SHA-256 作为密钥材料（应使用 GenerateKeyfile 生成的高熵文件）
+type Keyfile struct {
+	Path   string
+	secret []byte
+	id     string
+}
+
+// LoadKeyfile 读取密钥文件
+func LoadKeyfile(path string) (*Keyfile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+	if info.Size() == 0 || info.Size() > maxKeyfileSize {
+		return nil, fmt.Errorf("%w: 密钥文件 %s 为空或超过 1MiB", ErrInvalidKey, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	clear(data)
+	return &Keyfile{Path: path, secret: sum[:], id: shortID("beanckup-keyfile-id:", sum[:])}, nil
+}
+
+// GenerateKeyfile 生成包含 32 字节随机数的密钥文件，文件已存在时拒绝覆盖
+func GenerateKeyfile(path string) (*Keyfile, error) {
+	secret := make([]byte, generatedKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("生成随机数失败: %w", err)
+	}
+	defer clear(secret)
+	content := fmt.Sprintf("%s\n%s\n", keyfileHeader, base64.StdEncoding.EncodeToString(secret))
+	if err := writeSecretFile(path, []byte(content)); err != nil {
+		return nil, err
+	}
+	return LoadKeyfile(path)
+}
+
+// ID 返回密钥文件的标识
+func (k *Keyfile) ID() string {
+	return k.id
+}
+
+// wrap 以密钥文件派生的密钥封装 DEK，每次封装使用新的随机盐
+func (k *Keyfile) wrap(dek []byte) (*stanza, error) {
+	salt := make([]byte, keyfileSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("生成随机盐失败: %w", err)
+	}
+	kek, err := deriveWrappingKey(k.secret, salt, "beanckup keyfile")
+	if err != nil {
+		return nil, err
+	}
+	defer clear(kek)
+	wrapped, err := wrapKey(kek, dek, RecipientKeyfile, k.id)
+	if err != nil {
+		return nil, err
+	}
+	return &stanza{Type: RecipientKeyfile, KeyID: k.id, Salt: salt, WrappedKey: wrapped}, nil
+}
+
+// unwrap 解开为该密钥文件封装的 DEK
+func (k *Keyfile) unwrap(s *stanza) ([]byte, error) {
+	kek, err := deriveWrappingKey(k.secret, s.Salt, "beanckup keyfile")
+	if err != nil {
+		return nil, err
+	}
+	defer clear(kek)
+	return unwrapKey(kek, s.WrappedKey, []byte(s.Type+":"+s.KeyID))
+}
+
+// info 返回密钥文件接收者的描述
+func (k *Keyfile) info() types.RecipientInfo {
+	return types.RecipientInfo{Type: RecipientKeyfile, KeyID: k.id}
+}
+
+// PublicKey X25519 接收者公钥，文本形式为 beanckup-pub-<base64url>
+type PublicKey struct {
+	key *ecdh.PublicKey
+	id  string
+}
+
+// ParsePublicKey 解析文本形式的接收者公钥
+func ParsePublicKey(text string) (*PublicKey, error) {
+	text = strings.TrimSpace(text)
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(text, publicKeyPrefix))
+	if !strings.HasPrefix(text, publicKeyPrefix) || err != nil {
+		return nil, fmt.Errorf("%w: 无法识别的公钥 %q", ErrInvalidKey, text)
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return &PublicKey{key: key, id: shortID("beanckup-x25519-id:", raw)}, nil
+}
+
+// String 返回公钥的文本形式
+func (p *PublicKey) String() string {
+	return publicKeyPrefix + base64.RawURLEncoding.EncodeToString(p.key.Bytes())
+}
+
+// ID 返回公钥的标识
+func (p *PublicKey) ID() string {
+	return p.id
+}
+
+// wrap 以一次性的临时密钥与接收者公钥协商出的共享密钥封装 DEK
+func (p *PublicKey) wrap(dek []byte) (*stanza, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成临时密钥失败: %w", err)
+	}
+	shared, err := ephemeral.ECDH(p.key)
+	if err != nil {
+		return nil, fmt.Errorf("密钥协商失败: %w", err)
+	}
+	defer clear(shared)
+	salt := append(ephemeral.PublicKey().Bytes(), p.key.Bytes()...)
+	kek, err := deriveWrappingKey(shared, salt, "beanckup x25519")
+	if err != nil {
+		return nil, err
+	}
+	defer clear(kek)
+	wrapped, err := wrapKey(kek, dek, RecipientX25519, p.id)
+	if err != nil {
+		return nil, err
+	}
+	return &stanza{Type: RecipientX25519, KeyID: p.id, Ephemeral: ephemeral.PublicKey().Bytes(), WrappedKey: wrapped}, nil
+}
+
+// info 返回公钥接收者的描述
+func (p *PublicKey) info() types.RecipientInfo {
+	return types.RecipientInfo{Type: RecipientX25519, KeyID: p.id, PublicKey: p.String()}
+}
+
+// Identity X25519 私钥，用于解开为对应公钥封装的 DEK
+// 私钥文件中以 # 开头的行为注释，其余第一行为 BEANCKUP-SECRET-KEY-<base64url>
+type Identity struct {
+	Path string
+	key  *ecdh.PrivateKey
+}
+
+// LoadIdentity 读取私钥文件
+func LoadIdentity(path string) (*Identity, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取私钥文件失败: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(io.LimitReader(file, maxKeyfileSize))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(line, identityPrefix))
+		if !strings.HasPrefix(line, identityPrefix) || err != nil {
+			break
+		}
+		key, err := ecdh.X25519().NewPrivateKey(raw)
+		clear(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		return &Identity{Path: path, key: key}, nil
+	}
+	return nil, fmt.Errorf("%w: %s 中没有私钥", ErrInvalidKey, path)
+}
+
+// GenerateIdentity 生成新的 X25519 私钥写入 path（文件已存在时拒绝覆盖），返回私钥及其公钥
+func GenerateIdentity(path string) (*Identity, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成私钥失败: %w", err)
+	}
+	identity := &Identity{Path: path, key: key}
+	raw := key.Bytes()
+	defer clear(raw)
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "# public key: %s\n", identity.Recipient())
+	fmt.Fprintf(&content, "%s%s\n", identityPrefix, base64.RawURLEncoding.EncodeToString(raw))
+	defer clear(content.Bytes())
+	if err := writeSecretFile(path, content.Bytes()); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// Recipient 返回私钥对应的公钥
+func (i *Identity) Recipient() *PublicKey {
+	raw := i.key.PublicKey().Bytes()
+	return &PublicKey{key: i.key.PublicKey(), id: shortID("beanckup-x25519-id:", raw)}
+}
+
+// unwrap 解开为该私钥对应公钥封装的 DEK
+func (i *Identity) unwrap(s *stanza) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().NewPublicKey(s.Ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 临时公钥无效", ErrCorrupted)
+	}
+	shared, err := i.key.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("密钥协商失败: %w", err)
+	}
+	defer clear(shared)
+	salt := append(append([]byte{}, s.Ephemeral...), i.key.PublicKey().Bytes()...)
+	kek, err := deriveWrappingKey(shared, salt, "beanckup x25519")
+	if err != nil {
+		return nil, err
+	}
+	defer clear(kek)
+	return unwrapKey(kek, s.WrappedKey, []byte(s.Type+":"+s.KeyID))
+}
+
+// writeSecretFile 以仅所有者可读写的权限创建新文件
+func writeSecretFile(path string, content []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%w: %s", ErrKeyExists, path)
+		}
+		return fmt.Errorf("创建密钥文件失败: %w", err)
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return fmt.Errorf("写入密钥文件失败: %w", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,512 @@
+package encryptor
+
+import (
+	"beanckup/backend/types"
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	magic         = "BKCRYPT1"
+	formatVersion = 1
+	chunkSize     = 64 * 1024 // 明文分块大小
+	prefixSize    = 16        // 分块随机数前缀，后 8 字节为分块序号
+	maxHeaderSize = 1 << 20
+)
+
+// header 加密数据的头部，记录为每个接收者封装的 DEK
+// 文件结构：magic | 头部长度（4 字节，小端） | 头部 JSON | 依次排列的密文分块（每块附 16 字节认证标签）
+// 每个分块的附加数据为随机数前缀加上是否为末块的标记，分块被替换、重排或截断都无法通过认证；
+// 头部另有以 DEK 派生密钥计算的 HMAC，接收者列表可以在不重新加密内容的情况下重写（密钥轮换）
+type header struct {
+	Version     int       `json:"version"`
+	Algorithm   string    `json:"algorithm"`
+	ChunkSize   int       `json:"chunkSize"`
+	NoncePrefix []byte    `json:"noncePrefix"`
+	Recipients  []*stanza `json:"recipients,omitempty"`
+	MAC         []byte    `json:"mac,omitempty"`
+}
+
+// info 返回头部描述的加密信息
+func (h *header) info() *types.EncryptionInfo {
+	info := &types.EncryptionInfo{Mode: types.EncryptionNative, Algorithm: h.Algorithm, ChunkSize: h.ChunkSize}
+	for _, s := range h.Recipients {
+		info.Recipients = append(info.Recipients, types.RecipientInfo{Type: s.Type, KeyID: s.KeyID, KDF: s.KDF})
+	}
+	return info
+}
+
+// mac 计算头部（不含 MAC 字段）的 HMAC-SHA256，密钥由 DEK 派生
+func (h *header) mac(dek []byte) ([]byte, error) {
+	unsigned := *h
+	unsigned.MAC = nil
+	encoded, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("编码加密头部失败: %w", err)
+	}
+	macKey, err := deriveWrappingKey(dek, nil, "beanckup header mac")
+	if err != nil {
+		return nil, err
+	}
+	defer clear(macKey)
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(encoded)
+	return mac.Sum(nil), nil
+}
+
+// newHeader 为每个接收者封装 DEK 并计算头部 MAC
+func newHeader(prefix, dek []byte, recipients []Recipient) (*header, error) {
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+	h := &header{
+		Version:     formatVersion,
+		Algorithm:   Algorithm,
+		ChunkSize:   chunkSize,
+		NoncePrefix: prefix,
+	}
+	for _, recipient := range recipients {
+		s, err := recipient.wrap(dek)
+		if err != nil {
+			return nil, err
+		}
+		h.Recipients = append(h.Recipients, s)
+	}
+	mac, err := h.mac(dek)
+	if err != nil {
+		return nil, err
+	}
+	h.MAC = mac
+	return h, nil
+}
+
+// encode 返回头部在文件中的完整字节：magic | 长度 | JSON
+func (h *header) encode() ([]byte, error) {
+	encoded, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("编码加密头部失败: %w", err)
+	}
+	head := make([]byte, 0, len(magic)+4+len(encoded))
+	head = append(head, magic...)
+	head = binary.LittleEndian.AppendUint32(head, uint32(len(encoded)))
+	return append(head, encoded...), nil
+}
+
+// readHeader 读取并解析头部，返回头部与其原始字节（长度即密文的起始位置）
+func readHeader(r io.ReaderAt, size int64) (*header, []byte, error) {
+	prelude := make([]byte, len(magic)+4)
+	if _, err := r.ReadAt(prelude, 0); err != nil || string(prelude[:len(magic)]) != magic {
+		return nil, nil, ErrNotEncrypted
+	}
+	headerSize := int64(binary.LittleEndian.Uint32(prelude[len(magic):]))
+	dataStart := int64(len(prelude)) + headerSize
+	if headerSize > maxHeaderSize || dataStart > size {
+		return nil, nil, fmt.Errorf("%w: 头部长度 %d", ErrCorrupted, headerSize)
+	}
+	head := make([]byte, dataStart)
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return nil, nil, fmt.Errorf("读取加密头部失败: %w", err)
+	}
+	var h header
+	if err := json.Unmarshal(head[len(prelude):], &h); err != nil {
+		return nil, nil, fmt.Errorf("%w: 加密头部无法解析: %v", ErrCorrupted, err)
+	}
+	if h.Version != formatVersion || h.Algorithm != Algorithm || h.ChunkSize != chunkSize || len(h.NoncePrefix) != prefixSize {
+		return nil, nil, fmt.Errorf("%w: 版本 %d，算法 %s，分块 %d", ErrUnsupportedFormat, h.Version, h.Algorithm, h.ChunkSize)
+	}
+	return &h, head, nil
+}
+
+// openHeader 用密钥环解开 DEK，并校验头部 MAC
+func openHeader(h *header, keys *Keyring) ([]byte, error) {
+	dek, err := keys.unwrap(h.Recipients)
+	if err != nil {
+		return nil, err
+	}
+	mac, err := h.mac(dek)
+	if err != nil {
+		clear(dek)
+		return nil, err
+	}
+	if !hmac.Equal(mac, h.MAC) {
+		clear(dek)
+		return nil, fmt.Errorf("%w: 加密头部校验失败", ErrCorrupted)
+	}
+	return dek, nil
+}
+
+// chunkNonce 返回分块的随机数
+func chunkNonce(prefix []byte, index uint64) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[prefixSize:], index)
+	return nonce
+}
+
+// chunkAD 返回分块的附加数据
+func chunkAD(prefix []byte, final bool) []byte {
+	ad := make([]byte, len(prefix)+1)
+	copy(ad, prefix)
+	if final {
+		ad[len(prefix)] = 1
+	}
+	return ad
+}
+
+// Writer 原生加密层的写入端，把写入的数据按块加密后写入底层 Writer
+// 每个 Writer 使用随机生成的 DEK；Close 写入末块并清零缓冲区，但不关闭底层 Writer
+type Writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	buf     []byte
+	sealed  []byte
+	counter uint64
+	closed  bool
+}
+
+// NewWriter 创建加密写入端，为每个接收者封装 DEK 并立即写入头部
+func NewWriter(w io.Writer, recipients []Recipient) (*Writer, error) {
+	dek := make([]byte, chacha20poly1305.KeySize)
+	defer clear(dek)
+	prefix := make([]byte, prefixSize)
+	for _, b := range [][]byte{dek, prefix} {
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("生成随机数失败: %w", err)
+		}
+	}
+	aead, err := chacha20poly1305.NewX(dek)
+	if err != nil {
+		return nil, fmt.Errorf("初始化密钥失败: %w", err)
+	}
+	h, err := newHeader(prefix, dek, recipients)
+	if err != nil {
+		return nil, err
+	}
+	head, err := h.encode()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(head); err != nil {
+		return nil, fmt.Errorf("写入加密头部失败: %w", err)
+	}
+	return &Writer{
+		w:      w,
+		aead:   aead,
+		prefix: prefix,
+		buf:    make([]byte, 0, chunkSize),
+		sealed: make([]byte, 0, chunkSize+chacha20poly1305.Overhead),
+	}, nil
+}
+
+// Write 缓冲数据，凑满一块且确认后面还有数据时才加密写出，使末块总能被标记
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("加密写入端已关闭")
+	}
+	n := len(p)
+	for len(p) > 0 {
+		if len(w.buf) == chunkSize {
+			if err := w.seal(false); err != nil {
+				return n - len(p), err
+			}
+		}
+		take := min(chunkSize-len(w.buf), len(p))
+		w.buf = append(w.buf, p[:take]...)
+		p = p[take:]
+	}
+	return n, nil
+}
+
+// seal 加密并写出缓冲区中的一块
+func (w *Writer) seal(final bool) error {
+	w.sealed = w.aead.Seal(w.sealed[:0], chunkNonce(w.prefix, w.counter), w.buf, chunkAD(w.prefix, final))
+	clear(w.buf)
+	w.buf = w.buf[:0]
+	w.counter++
+	if _, err := w.w.Write(w.sealed); err != nil {
+		return fmt.Errorf("写入密文失败: %w", err)
+	}
+	return nil
+}
+
+// Close 写入末块并清零缓冲区
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.seal(true)
+}
+
+// Reader 原生加密层的读取端，支持随机读取：按需解密所在的分块并缓存最近一块
+type Reader struct {
+	r          io.ReaderAt
+	aead       cipher.AEAD
+	prefix     []byte
+	dataStart  int64
+	chunkCount int64
+	lastSize   int64 // 末块密文长度
+	size       int64 // 明文总长度
+	info       *types.EncryptionInfo
+
+	mu     sync.Mutex
+	cached int64
+	plain  []byte
+	sealed []byte
+}
+
+// NewReader 读取头部，用密钥环中的密码、密钥文件或私钥解开 DEK；size 为密文总长度
+func NewReader(r io.ReaderAt, size int64, keys *Keyring) (*Reader, error) {
+	h, head, err := readHeader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := openHeader(h, keys)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(dek)
+	clear(dek)
+	if err != nil {
+		return nil, fmt.Errorf("初始化密钥失败: %w", err)
+	}
+
+	dataStart := int64(len(head))
+	stride := int64(chunkSize + chacha20poly1305.Overhead)
+	sealedSize := size - dataStart
+	chunkCount := (sealedSize + stride - 1) / stride
+	lastSize := sealedSize - (chunkCount-1)*stride
+	if chunkCount == 0 || lastSize < chacha20poly1305.Overhead {
+		return nil, fmt.Errorf("%w: 密文长度 %d", ErrCorrupted, sealedSize)
+	}
+
+	return &Reader{
+		r:          r,
+		aead:       aead,
+		prefix:     h.NoncePrefix,
+		dataStart:  dataStart,
+		chunkCount: chunkCount,
+		lastSize:   lastSize,
+		size:       (chunkCount-1)*chunkSize + lastSize - chacha20poly1305.Overhead,
+		info:       h.info(),
+		cached:     -1,
+	}, nil
+}
+
+// Size 返回明文总长度
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// Info 返回加密信息
+func (r *Reader) Info() *types.EncryptionInfo {
+	return r.info
+}
+
+// ReadAt 读取明文中从 off 开始的数据，涉及的分块都会经过认证
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("无效的读取位置 %d", off)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) && off < r.size {
+		index := off / chunkSize
+		plain, err := r.chunk(index)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], plain[off-index*chunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// chunk 解密并返回第 index 块的明文，调用方需持有锁
+func (r *Reader) chunk(index int64) ([]byte, error) {
+	if index == r.cached {
+		return r.plain, nil
+	}
+	stride := int64(chunkSize + chacha20poly1305.Overhead)
+	length := stride
+	final := index == r.chunkCount-1
+	if final {
+		length = r.lastSize
+	}
+	if cap(r.sealed) < int(length) {
+		r.sealed = make([]byte, stride)
+	}
+	sealed := r.sealed[:length]
+	if _, err := r.r.ReadAt(sealed, r.dataStart+index*stride); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("读取密文失败: %w", err)
+	}
+	plain, err := r.aead.Open(r.plain[:0], chunkNonce(r.prefix, uint64(index)), sealed, chunkAD(r.prefix, final))
+	if err != nil {
+		r.cached = -1
+		return nil, fmt.Errorf("%w: 第 %d 块", ErrCorrupted, index)
+	}
+	r.plain = plain
+	r.cached = index
+	return plain, nil
+}
+
+// wipe 清零缓存的明文
+func (r *Reader) wipe() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.plain[:cap(r.plain)])
+	r.cached = -1
+}
+
+// File 打开的加密文件
+type File struct {
+	*Reader
+	file *os.File
+}
+
+// OpenFile 打开经原生加密层加密的文件
+func OpenFile(path string, keys *Keyring) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开加密文件失败: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("读取加密文件失败: %w", err)
+	}
+	reader, err := NewReader(file, info.Size(), keys)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &File{Reader: reader, file: file}, nil
+}
+
+// Close 清零缓存的明文并关闭文件
+func (f *File) Close() error {
+	f.wipe()
+	return f.file.Close()
+}
+
+// IsEncrypted 判断数据是否由原生加密层加密
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+// Seal 为指定接收者加密一段完整的数据（例如清单）
+func Seal(data []byte, recipients []Recipient) ([]byte, error) {
+	var out bytes.Buffer
+	w, err := NewWriter(&out, recipients)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Open 解密由 Seal 加密的数据，返回明文与加密信息；所有分块（包括空数据的末块）都会经过认证
+func Open(data []byte, keys *Keyring) ([]byte, *types.EncryptionInfo, error) {
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)), keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make([]byte, 0, r.Size())
+	for index := int64(0); index < r.chunkCount; index++ {
+		plain, err := r.chunk(index)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, plain...)
+	}
+	r.wipe()
+	return out, r.Info(), nil
+}
+
+// Rewrap 重新封装加密数据的 DEK：用密钥环解开后为新的接收者重新封装，写出新的头部，密文分块原样复制，不重新加密内容
+func Rewrap(r io.ReaderAt, size int64, w io.Writer, keys *Keyring, recipients []Recipient) (*types.EncryptionInfo, error) {
+	h, head, err := readHeader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := openHeader(h, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(dek)
+
+	rewrapped, err := newHeader(h.NoncePrefix, dek, recipients)
+	if err != nil {
+		return nil, err
+	}
+	newHead, err := rewrapped.encode()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(newHead); err != nil {
+		return nil, fmt.Errorf("写入加密头部失败: %w", err)
+	}
+	dataStart := int64(len(head))
+	if _, err := io.Copy(w, io.NewSectionReader(r, dataStart, size-dataStart)); err != nil {
+		return nil, fmt.Errorf("复制密文失败: %w", err)
+	}
+	return rewrapped.info(), nil
+}
+
+// RewrapFile 原地重新封装加密文件的 DEK：新文件先写入同目录的临时文件，同步后替换原文件，中途失败时原文件保持不变
+func RewrapFile(path string, keys *Keyring, recipients []Recipient) (*types.EncryptionInfo, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开加密文件失败: %w", err)
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("读取加密文件失败: %w", err)
+	}
+
+	tmpPath := path + ".rewrap"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, stat.Mode().Perm())
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	info, err := Rewrap(src, stat.Size(), tmp, keys, recipients)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		src.Close()
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	return info, nil
+}
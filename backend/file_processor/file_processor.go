@@ -1,6 +1,7 @@
 package file_processor
 
 import (
+	"beanckup/backend/throttle"
 	"beanckup/backend/types"
 	"io"
 	"os"
@@ -14,13 +15,20 @@ type Processor interface {
 }
 
 // Manager 文件处理器实现
-type Manager struct{}
+type Manager struct {
+	readLimiter *throttle.Limiter
+}
 
 // NewManager 创建新的文件处理器
 func NewManager() *Manager {
 	return &Manager{}
 }
 
+// SetReadLimiter 设置读取限速器，nil 表示不限速
+func (m *Manager) SetReadLimiter(limiter *throttle.Limiter) {
+	m.readLimiter = limiter
+}
+
 // ProcessFiles 处理文件列表，根据大小进行分流
 func (m *Manager) ProcessFiles(changedFiles map[string]*types.FileInfo, threshold int64) (*types.ProcessingResult, error) {
 	result := &types.ProcessingResult{
@@ -69,7 +77,7 @@ func (m *Manager) createSmallFileTask(filePath string, fileInfo *types.FileInfo)
 	defer file.Close()
 
 	// 读取所有内容
-	content, err := io.ReadAll(file)
+	content, err := io.ReadAll(throttle.Reader(file, m.readLimiter))
 	if err != nil {
 		return nil, err
 	}
@@ -2,6 +2,7 @@ package indexer
 
 import (
 	"beanckup/backend/types"
+	"bytes"
 	"io/fs"
 	"log"
 	"os"
@@ -11,8 +12,8 @@ import (
 
 // Indexer 索引器接口
 type Indexer interface {
-	// 扫描工作区，找出需要处理的文件
-	ScanWorkspace(workspacePath string) (map[string]*types.FileInfo, error)
+	// 扫描工作区，找出需要处理的文件与全部目录
+	ScanWorkspace(workspacePath string, callback ProgressCallback) (map[string]*types.FileInfo, map[string]*types.DirInfo, error)
 
 	// 快速扫描：对比元数据，找出嫌疑人
 	QuickScan(currentFiles map[string]*types.FileInfo, previousManifest *types.Manifest) map[string]*types.FileInfo
@@ -37,11 +38,13 @@ func NewManager() *Manager {
 // ProgressCallback 是一个回调函数类型，用于在扫描过程中报告进度
 type ProgressCallback func(processedCount int, totalCount int)
 
-// ScanWorkspace 扫描指定路径下的所有文件，并返回它们的信息
+// ScanWorkspace 扫描指定路径下的所有文件与目录，并返回它们的信息
 // 这个实现是健壮的，可以处理符号链接并提供进度报告
-func (m *Manager) ScanWorkspace(workspacePath string, callback ProgressCallback) (map[string]*types.FileInfo, error) {
+// 目录包括空目录，不包括工作区根目录，只记录修改时间；文件数与总大小由 AggregateDirectories 按清单中的文件汇总
+func (m *Manager) ScanWorkspace(workspacePath string, callback ProgressCallback) (map[string]*types.FileInfo, map[string]*types.DirInfo, error) {
 	log.Printf("Indexer: Starting to scan workspace: %s", workspacePath)
 	files := make(map[string]*types.FileInfo)
+	dirs := make(map[string]*types.DirInfo)
 
 	// 第一步：先遍历一次，统计文件总数，用于计算进度
 	var totalFiles int
@@ -63,7 +66,7 @@ func (m *Manager) ScanWorkspace(workspacePath string, callback ProgressCallback)
 	})
 	log.Printf("Indexer: Found %d total files to process.", totalFiles)
 
-	// 第二步：正式遍历，收集文件信息
+	// 第二步：正式遍历，收集文件与目录信息
 	var processedFiles int
 	err := filepath.WalkDir(workspacePath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -80,14 +83,22 @@ func (m *Manager) ScanWorkspace(workspacePath string, callback ProgressCallback)
 			return nil
 		}
 
-		if d.IsDir() {
-			return nil // 是目录，直接返回
-		}
-
 		info, err := d.Info()
 		if err != nil {
 			log.Printf("Indexer: Could not get FileInfo for %s: %v", path, err)
-			return nil // 跳过无法获取信息的文件
+			return nil // 跳过无法获取信息的文件或目录
+		}
+
+		if d.IsDir() {
+			// 是目录，记录修改时间后继续遍历；工作区根目录不记录
+			if path != workspacePath {
+				dirs[path] = &types.DirInfo{
+					Path:    path,
+					Name:    info.Name(),
+					ModTime: info.ModTime(),
+				}
+			}
+			return nil
 		}
 
 		// 创建 FileInfo 对象
@@ -112,7 +123,7 @@ func (m *Manager) ScanWorkspace(workspacePath string, callback ProgressCallback)
 
 	if err != nil {
 		log.Printf("Indexer: A critical error occurred during scanning: %v", err)
-		return nil, err
+		return nil, nil, err
 	}
 
 	// 确保最后一次进度被报告
@@ -120,8 +131,95 @@ func (m *Manager) ScanWorkspace(workspacePath string, callback ProgressCallback)
 		callback(processedFiles, totalFiles)
 	}
 
-	log.Printf("Indexer: Finished scanning. Processed %d files.", processedFiles)
-	return files, nil
+	log.Printf("Indexer: Finished scanning. Processed %d files and %d directories.", processedFiles, len(dirs))
+	return files, dirs, nil
+}
+
+// AggregateDirectories 按文件汇总每个目录（含各级子目录）中的文件数与总大小
+func AggregateDirectories(dirs map[string]*types.DirInfo, files map[string]*types.FileInfo) {
+	for _, dir := range dirs {
+		dir.FileCount = 0
+		dir.TotalSize = 0
+	}
+	for path, file := range files {
+		for parent := filepath.Dir(path); ; parent = filepath.Dir(parent) {
+			dir, exists := dirs[parent]
+			if !exists {
+				break
+			}
+			dir.FileCount++
+			dir.TotalSize += file.Size
+		}
+	}
+}
+
+// CaptureMetadata 为扫描到的文件与目录读取权限、属主与扩展属性（目前只支持 Linux）
+// 读取失败的条目不记录元数据，也就不会被判定为元数据变化
+func (m *Manager) CaptureMetadata(files map[string]*types.FileInfo, dirs map[string]*types.DirInfo) {
+	failed := 0
+	for path, file := range files {
+		meta, err := readPosix(path)
+		if err != nil {
+			log.Printf("Indexer: Could not read metadata for %s: %v", path, err)
+			failed++
+			continue
+		}
+		file.Posix = meta
+	}
+	for path, dir := range dirs {
+		meta, err := readPosix(path)
+		if err != nil {
+			log.Printf("Indexer: Could not read metadata for directory %s: %v", path, err)
+			failed++
+			continue
+		}
+		dir.Posix = meta
+	}
+	log.Printf("Indexer: Captured metadata for %d files and %d directories (%d failed).", len(files), len(dirs), failed)
+}
+
+// PosixChanged 判断权限、属主或扩展属性是否变化；本次没有记录元数据（未开启或平台不支持）时不比较
+func PosixChanged(current, previous *types.PosixMeta) bool {
+	if current == nil {
+		return false
+	}
+	if previous == nil {
+		return true
+	}
+	if current.Mode != previous.Mode || current.UID != previous.UID || current.GID != previous.GID {
+		return true
+	}
+	if len(current.Xattrs) != len(previous.Xattrs) {
+		return true
+	}
+	for name, value := range current.Xattrs {
+		previousValue, exists := previous.Xattrs[name]
+		if !exists || !bytes.Equal(value, previousValue) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareDirectories 返回与上次清单相比新增、删除、修改时间或权限等元数据变化的目录数
+func (i *Manager) CompareDirectories(currentDirs map[string]*types.DirInfo, previousManifest *types.Manifest) int {
+	var previousDirs map[string]*types.DirInfo
+	if previousManifest != nil {
+		previousDirs = previousManifest.Dirs
+	}
+	changed := 0
+	for path, current := range currentDirs {
+		previous, exists := previousDirs[path]
+		if !exists || !current.ModTime.Equal(previous.ModTime) || PosixChanged(current.Posix, previous.Posix) {
+			changed++
+		}
+	}
+	for path := range previousDirs {
+		if _, exists := currentDirs[path]; !exists {
+			changed++
+		}
+	}
+	return changed
 }
 
 // QuickScan 快速扫描：对比元数据，找出嫌疑人
@@ -151,6 +249,10 @@ func (i *Manager) QuickScan(currentFiles map[string]*types.FileInfo, previousMan
 			if i.hasMetadataChanged(currentFile, previousFile) {
 				currentFile.Status = types.StatusModified
 				suspects[filePath] = currentFile
+			} else if PosixChanged(currentFile.Posix, previousFile.Posix) {
+				// 内容未变，只有权限、属主或扩展属性变化，无需重新打包
+				currentFile.Status = types.StatusMetadata
+				suspects[filePath] = currentFile
 			}
 			// 如果元数据完全匹配，保持StatusUnchanged，不加入嫌疑人列表
 		}
@@ -0,0 +1,78 @@
+//go:build linux
+
+package indexer
+
+import (
+	"beanckup/backend/types"
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// readPosix 读取文件或目录的权限、属主与扩展属性，不跟随符号链接
+func readPosix(path string) (*types.PosixMeta, error) {
+	var stat unix.Stat_t
+	if err := unix.Lstat(path, &stat); err != nil {
+		return nil, fmt.Errorf("读取文件属性失败: %w", err)
+	}
+	xattrs, err := readXattrs(path)
+	if err != nil {
+		return nil, err
+	}
+	return &types.PosixMeta{
+		Mode:   stat.Mode & 07777,
+		UID:    int(stat.Uid),
+		GID:    int(stat.Gid),
+		Xattrs: xattrs,
+	}, nil
+}
+
+// readXattrs 读取全部扩展属性（包括 ACL），文件系统不支持扩展属性时返回空
+// 没有权限读取的命名空间（如非 root 时的 trusted.*）不会出现在列表中
+func readXattrs(path string) (map[string][]byte, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if errors.Is(err, unix.ENOTSUP) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取扩展属性失败: %w", err)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	list := make([]byte, size)
+	if size, err = unix.Llistxattr(path, list); err != nil {
+		return nil, fmt.Errorf("读取扩展属性失败: %w", err)
+	}
+
+	xattrs := make(map[string][]byte)
+	for _, name := range bytes.Split(list[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := readXattr(path, string(name))
+		if errors.Is(err, unix.ENODATA) {
+			continue // 读取列表后被删除
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取扩展属性 %s 失败: %w", name, err)
+		}
+		xattrs[string(name)] = value
+	}
+	return xattrs, nil
+}
+
+// readXattr 读取单个扩展属性的值
+func readXattr(path, name string) ([]byte, error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	if size, err = unix.Lgetxattr(path, name, value); err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package indexer
+
+import "beanckup/backend/types"
+
+// readPosix 当前平台尚未实现，不记录权限、属主与扩展属性
+func readPosix(path string) (*types.PosixMeta, error) {
+	return nil, nil
+}
@@ -14,4 +14,19 @@ var (
 
 	// ErrManifestCorrupted 清单已损坏
 	ErrManifestCorrupted = errors.New("清单已损坏")
+
+	// ErrUnsupportedFormat 不支持的清单格式版本
+	ErrUnsupportedFormat = errors.New("不支持的清单格式版本")
+
+	// ErrUnsupportedVersion 不支持的清单结构版本
+	ErrUnsupportedVersion = errors.New("不支持的清单结构版本")
+
+	// ErrMigrationFailed 清单无法迁移到当前结构版本
+	ErrMigrationFailed = errors.New("清单迁移失败")
+
+	// ErrPathOutsideWorkspace 路径不在工作区之内
+	ErrPathOutsideWorkspace = errors.New("路径不在工作区之内")
+
+	// ErrWorkspaceMismatch 清单属于另一个工作区
+	ErrWorkspaceMismatch = errors.New("清单属于另一个工作区")
 )
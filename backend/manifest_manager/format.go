@@ -0,0 +1,237 @@
+package manifest_manager
+
+import (
+	"beanckup/backend/types"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 清单的紧凑格式（版本 2）：zstd 压缩的 JSON Lines
+// 第一行为头部（格式版本与除文件、目录、哈希索引以外的清单字段），之后每行一个文件或目录；
+// 映射的键只在与记录中的路径不同时写出，HashToFile 不写入，读取时按文件重建。
+// 版本 1 为缩进的 JSON，读取时自动识别，下次保存时改写为紧凑格式。
+// 格式版本与清单的结构版本（见 schema.go）相互独立：两种格式读取后都按清单记录的结构版本解码与迁移。
+const formatVersion = 2
+
+// zstdMagic zstd 帧的魔数，用于区分紧凑格式与版本 1 的 JSON
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// compactHeader 紧凑格式的第一行，清单字段按其结构版本解码
+type compactHeader struct {
+	Format   int             `json:"format"`
+	Manifest json.RawMessage `json:"manifest"`
+}
+
+// compactLine 紧凑格式中的一行文件或目录记录
+type compactLine struct {
+	Key  string          `json:"k,omitempty"` // 映射的键，与记录中的路径相同时省略
+	File *types.FileInfo `json:"f,omitempty"`
+	Dir  *types.DirInfo  `json:"d,omitempty"`
+}
+
+// EncodeManifest 以紧凑格式写出清单的保存形式（见 StoredForm）：文件与目录的键及路径在编码时逐条转换为相对于 WorkspacePath 的路径，
+// 不复制整个清单，也不在内存中构造完整的 JSON
+func EncodeManifest(w io.Writer, manifest *types.Manifest) error {
+	if manifest.WorkspacePath == "" {
+		return fmt.Errorf("%w: 清单没有记录工作区路径", ErrPathOutsideWorkspace)
+	}
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return fmt.Errorf("初始化压缩失败: %w", err)
+	}
+	if err := encodeLines(zw, manifest); err != nil {
+		zw.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("写入清单失败: %w", err)
+	}
+	return nil
+}
+
+// encodeLines 写出头部与逐条的文件、目录记录，记录按保存形式的键排序
+// 空的目录映射保留在头部中（区分空映射与空值，保证读回的清单哈希不变）
+func encodeLines(w io.Writer, manifest *types.Manifest) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+
+	header := *manifest
+	header.Files = nil
+	header.HashToFile = nil
+	if len(header.Dirs) > 0 {
+		header.Dirs = nil
+	}
+	body, err := json.Marshal(&header)
+	if err != nil {
+		return fmt.Errorf("序列化清单失败: %w", err)
+	}
+	if err := encoder.Encode(&compactHeader{Format: formatVersion, Manifest: body}); err != nil {
+		return fmt.Errorf("序列化清单失败: %w", err)
+	}
+
+	root := manifest.WorkspacePath
+	fileKeys, err := storedKeys(root, manifest.Files)
+	if err != nil {
+		return err
+	}
+	for _, key := range fileKeys {
+		file := *manifest.Files[key.path]
+		if file.Path, err = relativePath(root, file.Path); err != nil {
+			return err
+		}
+		line := compactLine{File: &file}
+		if key.stored != file.Path {
+			line.Key = key.stored
+		}
+		if err := encoder.Encode(&line); err != nil {
+			return fmt.Errorf("序列化清单失败: %w", err)
+		}
+	}
+	dirKeys, err := storedKeys(root, manifest.Dirs)
+	if err != nil {
+		return err
+	}
+	for _, key := range dirKeys {
+		dir := *manifest.Dirs[key.path]
+		if dir.Path, err = relativePath(root, dir.Path); err != nil {
+			return err
+		}
+		line := compactLine{Dir: &dir}
+		if key.stored != dir.Path {
+			line.Key = key.stored
+		}
+		if err := encoder.Encode(&line); err != nil {
+			return fmt.Errorf("序列化清单失败: %w", err)
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("写入清单失败: %w", err)
+	}
+	return nil
+}
+
+// storedKey 内存中映射的键（绝对路径）及其保存形式（相对路径）
+type storedKey struct {
+	path, stored string
+}
+
+// storedKeys 返回映射的键及其相对于 root 的保存形式，按保存形式排序，使相同的清单编码为相同的字节
+func storedKeys[V any](root string, items map[string]V) ([]storedKey, error) {
+	keys := make([]storedKey, 0, len(items))
+	for path := range items {
+		stored, err := relativePath(root, path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, storedKey{path, stored})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].stored < keys[j].stored })
+	return keys, nil
+}
+
+// DecodeManifest 读取清单，自动识别紧凑格式与版本 1 的 JSON，再按清单记录的结构版本解码并迁移到当前版本
+// 紧凑格式逐行解码，HashToFile 按文件重建；返回的清单为保存形式（相对路径），workspacePath 为读取工作区清单时的工作区路径，
+// 较早的清单没有记录工作区路径时用于迁移
+func DecodeManifest(r io.Reader, workspacePath string) (*types.Manifest, error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(len(zstdMagic))
+	if !bytes.Equal(magic, zstdMagic) {
+		var body json.RawMessage
+		if err := json.NewDecoder(buffered).Decode(&body); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrManifestCorrupted, err)
+		}
+		doc, err := newDocument(body, false)
+		if err != nil {
+			return nil, err
+		}
+		doc.root = workspacePath
+		return migrate(doc)
+	}
+
+	zr, err := zstd.NewReader(buffered)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrManifestCorrupted, err)
+	}
+	defer zr.Close()
+	decoder := json.NewDecoder(bufio.NewReader(zr))
+
+	var header compactHeader
+	if err := decoder.Decode(&header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrManifestCorrupted, err)
+	}
+	if header.Format != formatVersion || len(header.Manifest) == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedFormat, header.Format)
+	}
+	doc, err := newDocument(header.Manifest, true)
+	if err != nil {
+		return nil, err
+	}
+	doc.root = workspacePath
+	for {
+		var line compactLine
+		if err := decoder.Decode(&line); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("%w: %v", ErrManifestCorrupted, err)
+		}
+		switch {
+		case line.File != nil:
+			doc.files[lineKey(line.Key, line.File.Path)] = line.File
+		case line.Dir != nil:
+			if doc.dirs == nil {
+				doc.dirs = make(map[string]*types.DirInfo)
+			}
+			doc.dirs[lineKey(line.Key, line.Dir.Path)] = line.Dir
+		}
+	}
+	return migrate(doc)
+}
+
+// ExportJSON 以缩进的 JSON 写出清单（当前结构版本的保存形式），用于调试与查看
+func ExportJSON(w io.Writer, manifest *types.Manifest) error {
+	stored, err := StoredForm(manifest)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(stored); err != nil {
+		return fmt.Errorf("导出清单失败: %w", err)
+	}
+	return nil
+}
+
+// RebuildHashIndex 根据清单中现存的文件重建 HashToFile，保证其指向的文件都仍然存在
+// 同一内容对应多个文件时取路径最小者，保证重建结果确定，读回的清单哈希与签名时一致
+func RebuildHashIndex(manifest *types.Manifest) {
+	manifest.HashToFile = hashIndex(manifest.Files)
+}
+
+// hashIndex 返回内容哈希到文件路径的映射，同一内容取路径最小的文件
+func hashIndex(files map[string]*types.FileInfo) map[string]string {
+	index := make(map[string]string)
+	for path, file := range files {
+		if file == nil || file.ContentHash == "" {
+			continue
+		}
+		if existing, exists := index[file.ContentHash]; !exists || path < existing {
+			index[file.ContentHash] = path
+		}
+	}
+	return index
+}
+
+// lineKey 返回记录在映射中的键，未单独写出时即记录中的路径
+func lineKey(key, path string) string {
+	if key != "" {
+		return key
+	}
+	return path
+}
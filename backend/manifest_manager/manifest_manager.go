@@ -1,18 +1,24 @@
 package manifest_manager
 
 import (
+	"beanckup/backend/encryptor"
 	"beanckup/backend/types"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 const (
 	manifestDir  = ".beanckup"
 	manifestFile = "manifest.json"
+	chainFile    = "chain.json"
 )
 
 // Manager 负责清单文件的读取和写入
@@ -28,8 +34,16 @@ func (m *Manager) getManifestPath(workspacePath string) string {
 	return filepath.Join(workspacePath, manifestDir, manifestFile)
 }
 
-// LoadLatestManifest 从工作区加载最新的清单文件
-// 如果清单不存在或损坏，则返回一个新的空清单，不返回错误
+// HasManifest 报告工作区中是否已有清单文件
+func (m *Manager) HasManifest(workspacePath string) bool {
+	_, err := os.Stat(m.getManifestPath(workspacePath))
+	return err == nil
+}
+
+// LoadLatestManifest 从工作区加载最新的清单文件，较早结构版本的清单在内存中迁移到当前版本
+// 清单中的相对路径按 workspacePath 展开，工作区移动到新位置后自动以新位置为根；清单记录的工作区标识与工作区不一致时返回错误
+// 如果清单不存在或损坏，则返回一个新的空清单，不返回错误；清单的格式或结构版本不受支持（由更新的程序生成），
+// 或较早结构版本的清单无法迁移时返回错误，避免把已有的备份当作首次备份而覆盖
 func (m *Manager) LoadLatestManifest(workspacePath string) (*types.Manifest, error) {
 	manifestPath := m.getManifestPath(workspacePath)
 	log.Printf("ManifestManager: Attempting to load manifest from %s", manifestPath)
@@ -37,41 +51,35 @@ func (m *Manager) LoadLatestManifest(workspacePath string) (*types.Manifest, err
 	if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
 		log.Println("ManifestManager: Manifest file not found. Creating a new empty manifest.")
 		// 文件不存在，是首次备份，返回一个空的清单对象
-		return &types.Manifest{
-			Version:    "1.0",
-			CreatedAt:  time.Now(),
-			Files:      make(map[string]*types.FileInfo),
-			Dirs:       make(map[string]*types.DirInfo),
-			HashToFile: make(map[string]string),
-		}, nil
+		return newEmptyManifest(), nil
 	}
 
-	// 文件存在，读取并解析
-	data, err := ioutil.ReadFile(manifestPath)
+	// 文件存在，逐行读取并解析
+	file, err := os.Open(manifestPath)
 	if err != nil {
 		log.Printf("ManifestManager: Error reading manifest file: %v. Returning a new empty manifest.", err)
 		// 读取失败也返回新清单，保证程序健灸性
-		return &types.Manifest{
-			Version:    "1.0",
-			CreatedAt:  time.Now(),
-			Files:      make(map[string]*types.FileInfo),
-			Dirs:       make(map[string]*types.DirInfo),
-			HashToFile: make(map[string]string),
-		}, nil
-	}
-
-	var manifest types.Manifest
-	if err := json.Unmarshal(data, &manifest); err != nil {
-		log.Printf("ManifestManager: Error unmarshalling manifest JSON: %v. Returning a new empty manifest.", err)
+		return newEmptyManifest(), nil
+	}
+	manifest, err := DecodeManifest(file, workspacePath)
+	file.Close()
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedVersion) || errors.Is(err, ErrUnsupportedFormat) || errors.Is(err, ErrMigrationFailed) {
+			log.Printf("ManifestManager: Refusing manifest %s: %v", manifestPath, err)
+			return nil, err
+		}
+		log.Printf("ManifestManager: Error decoding manifest: %v. Returning a new empty manifest.", err)
 		// 解析失败也返回新清单
-		return &types.Manifest{
-			Version:    "1.0",
-			CreatedAt:  time.Now(),
-			Files:      make(map[string]*types.FileInfo),
-			Dirs:       make(map[string]*types.DirInfo),
-			HashToFile: make(map[string]string),
-		}, nil
+		return newEmptyManifest(), nil
+	}
+	if err := m.checkWorkspaceIdentity(workspacePath, manifest); err != nil {
+		log.Printf("ManifestManager: Refusing manifest %s: %v", manifestPath, err)
+		return nil, err
+	}
+	if manifest.WorkspacePath != "" && filepath.Clean(manifest.WorkspacePath) != filepath.Clean(workspacePath) {
+		log.Printf("ManifestManager: Workspace moved from %s to %s, re-rooting manifest paths", manifest.WorkspacePath, workspacePath)
 	}
+	reroot(manifest, workspacePath)
 
 	// 为了后续处理方便，确保map不是nil
 	if manifest.Files == nil {
@@ -85,39 +93,301 @@ func (m *Manager) LoadLatestManifest(workspacePath string) (*types.Manifest, err
 	}
 
 	log.Printf("ManifestManager: Successfully loaded manifest created at %s", manifest.CreatedAt)
-	return &manifest, nil
+	return manifest, nil
 }
 
-// SaveManifest 将清单文件保存到工作区和交付路径
-func (m *Manager) SaveManifest(workspacePath, deliveryPath string, manifest *types.Manifest) error {
-	data, err := json.MarshalIndent(manifest, "", "  ")
+// newEmptyManifest 返回当前结构版本的空清单
+func newEmptyManifest() *types.Manifest {
+	return &types.Manifest{
+		Version:    types.ManifestVersion,
+		CreatedAt:  time.Now(),
+		Files:      make(map[string]*types.FileInfo),
+		Dirs:       make(map[string]*types.DirInfo),
+		HashToFile: make(map[string]string),
+	}
+}
+
+// LoadDeliveryManifest 从交付路径加载随交付包一起保存的清单，用于还原，较早结构版本的清单在内存中迁移到当前版本
+// 与 LoadLatestManifest 不同，清单不存在或损坏时返回错误；加密的清单用 keys 中的密码、密钥文件或私钥解密
+// 清单边读边解密、解码，不把整个文件或明文读入内存
+func (m *Manager) LoadDeliveryManifest(deliveryPath string, keys *encryptor.Keyring) (*types.Manifest, error) {
+	manifestPath := filepath.Join(deliveryPath, manifestFile)
+	encrypted, err := isEncryptedFile(manifestPath)
 	if err != nil {
-		log.Printf("ManifestManager: Error marshalling manifest to JSON: %v", err)
-		return err
+		return nil, err
+	}
+
+	var manifest *types.Manifest
+	if encrypted {
+		file, err := encryptor.OpenFile(manifestPath, keys)
+		if err != nil {
+			return nil, fmt.Errorf("解密清单失败: %w", err)
+		}
+		manifest, err = DecodeManifest(io.NewSectionReader(file, 0, file.Size()), "")
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		file, err := os.Open(manifestPath)
+		if err != nil {
+			return nil, fmt.Errorf("读取清单失败: %w", err)
+		}
+		manifest, err = DecodeManifest(file, "")
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	// 交付路径中的清单按记录的工作区路径展开，还原时据此计算文件的相对路径
+	reroot(manifest, manifest.WorkspacePath)
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]*types.FileInfo)
+	}
+	if manifest.Packages == nil {
+		manifest.Packages = make(map[string]string)
+	}
+
+	log.Printf("ManifestManager: Loaded delivery manifest created at %s", manifest.CreatedAt)
+	return manifest, nil
+}
+
+// isEncryptedFile 读取文件开头判断交付路径中的清单是否经原生加密层加密，文件不存在时返回 ErrManifestNotFound
+func isEncryptedFile(manifestPath string) (bool, error) {
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, fmt.Errorf("%w: %s", ErrManifestNotFound, manifestPath)
+		}
+		return false, fmt.Errorf("读取清单失败: %w", err)
+	}
+	defer file.Close()
+	prefix := make([]byte, 16)
+	n, err := io.ReadFull(file, prefix)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, fmt.Errorf("读取清单失败: %w", err)
 	}
+	return encryptor.IsEncrypted(prefix[:n]), nil
+}
 
-	// 1. 保存到工作区
+// SaveManifest 以紧凑格式将清单与清单链保存到工作区和交付路径，交付路径为空时只保存到工作区；文件与目录的路径保存为相对于工作区根目录的路径
+// recipients 不为空时交付路径中的清单经原生加密层加密；工作区中的清单与原文件同处一地，保持明文以便下次扫描无需密码；清单链不加密
+// 清单链与清单都先写入各自目录中的临时文件，全部写好后才依次改名替换（每个位置先清单链后清单），
+// 编码、加密或磁盘写满等中途失败时原有的清单与清单链都保持不变，不会出现清单与清单链最后一项不对应的情况
+func (m *Manager) SaveManifest(workspacePath, deliveryPath string, manifest *types.Manifest, chain *types.ManifestChain, recipients []encryptor.Recipient) error {
+	chainData, err := json.MarshalIndent(chain, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化清单链失败: %w", err)
+	}
 	workspaceManifestPath := m.getManifestPath(workspacePath)
 	// 确保 .beanckup 目录存在
 	if err := os.MkdirAll(filepath.Dir(workspaceManifestPath), 0755); err != nil {
 		log.Printf("ManifestManager: Error creating .beanckup directory in workspace: %v", err)
 		return err
 	}
-	if err := ioutil.WriteFile(workspaceManifestPath, data, 0644); err != nil {
+
+	var pending []*pendingFile
+	defer func() {
+		for _, file := range pending {
+			file.discard()
+		}
+	}()
+	// stage 为一个位置创建清单链与清单的临时文件，立即写入清单链，返回清单的临时文件
+	stage := func(chainPath, manifestPath string) (*pendingFile, error) {
+		chainTemp, err := newPendingFile(chainPath)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, chainTemp)
+		if _, err := chainTemp.file.Write(chainData); err != nil {
+			return nil, fmt.Errorf("写入清单链失败: %w", err)
+		}
+		manifestTemp, err := newPendingFile(manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, manifestTemp)
+		return manifestTemp, nil
+	}
+
+	workspaceFile, err := stage(filepath.Join(workspacePath, manifestDir, chainFile), workspaceManifestPath)
+	if err != nil {
 		log.Printf("ManifestManager: Error writing manifest to workspace: %v", err)
 		return err
 	}
-	log.Printf("ManifestManager: Successfully saved manifest to %s", workspaceManifestPath)
+	writers := []io.Writer{workspaceFile.file}
 
-	// 2. 如果提供了交付路径，也保存一份到交付路径
+	var sealer *encryptor.Writer
 	if deliveryPath != "" {
-		deliveryManifestPath := filepath.Join(deliveryPath, manifestFile)
-		if err := ioutil.WriteFile(deliveryManifestPath, data, 0644); err != nil {
+		deliveryFile, err := stage(filepath.Join(deliveryPath, chainFile), filepath.Join(deliveryPath, manifestFile))
+		if err != nil {
 			log.Printf("ManifestManager: Error writing manifest to delivery path: %v", err)
 			return err
 		}
-		log.Printf("ManifestManager: Successfully saved manifest to %s", deliveryManifestPath)
+		if len(recipients) > 0 {
+			if sealer, err = encryptor.NewWriter(deliveryFile.file, recipients); err != nil {
+				log.Printf("ManifestManager: Error encrypting manifest: %v", err)
+				return err
+			}
+			writers = append(writers, sealer)
+		} else {
+			writers = append(writers, deliveryFile.file)
+		}
 	}
 
+	if err := EncodeManifest(io.MultiWriter(writers...), manifest); err != nil {
+		log.Printf("ManifestManager: Error encoding manifest: %v", err)
+		return err
+	}
+	if sealer != nil {
+		if err := sealer.Close(); err != nil {
+			log.Printf("ManifestManager: Error encrypting manifest: %v", err)
+			return err
+		}
+	}
+	// 先把全部临时文件同步到磁盘，再依次改名，改名之前的任何失败都不会改动原有文件
+	for _, file := range pending {
+		if err := file.sync(); err != nil {
+			log.Printf("ManifestManager: Error writing manifest: %v", err)
+			return err
+		}
+	}
+	for _, file := range pending {
+		if err := file.commit(); err != nil {
+			log.Printf("ManifestManager: Error writing manifest: %v", err)
+			return err
+		}
+		log.Printf("ManifestManager: Successfully saved %s", file.path)
+	}
+	log.Printf("ManifestManager: Saved manifest chain with %d entries", len(chain.Entries))
 	return nil
 }
+
+// SaveChain 单独保存清单链（密钥轮换时追加的项不对应新的清单），workspacePath 或 deliveryPath 为空时跳过该位置
+// 同样先写入临时文件再改名替换，写入失败时原有的清单链保持不变
+func (m *Manager) SaveChain(workspacePath, deliveryPath string, chain *types.ManifestChain) error {
+	data, err := json.MarshalIndent(chain, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化清单链失败: %w", err)
+	}
+	var paths []string
+	if workspacePath != "" {
+		paths = append(paths, filepath.Join(workspacePath, manifestDir, chainFile))
+	}
+	if deliveryPath != "" {
+		paths = append(paths, filepath.Join(deliveryPath, chainFile))
+	}
+	for _, path := range paths {
+		file, err := newPendingFile(path)
+		if err != nil {
+			return err
+		}
+		if _, err := file.file.Write(data); err != nil {
+			file.discard()
+			return fmt.Errorf("写入清单链失败: %w", err)
+		}
+		err = file.sync()
+		if err == nil {
+			err = file.commit()
+		}
+		file.discard()
+		if err != nil {
+			log.Printf("ManifestManager: Error writing manifest chain: %v", err)
+			return err
+		}
+		log.Printf("ManifestManager: Successfully saved %s", path)
+	}
+	return nil
+}
+
+// pendingFile 写入中的临时文件，提交时改名为目标路径，使中途失败不会留下写了一半的清单或清单链
+type pendingFile struct {
+	file *os.File
+	path string
+	done bool
+}
+
+// newPendingFile 在目标路径所在的目录中创建临时文件
+func newPendingFile(path string) (*pendingFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), ".beanckup_"+strings.TrimSuffix(filepath.Base(path), ".json")+"_*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	return &pendingFile{file: file, path: path}, nil
+}
+
+// sync 设置权限并将临时文件同步到磁盘，磁盘写满等错误在替换目标文件之前暴露
+func (p *pendingFile) sync() error {
+	if err := p.file.Chmod(0644); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", p.path, err)
+	}
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", p.path, err)
+	}
+	return nil
+}
+
+// commit 关闭临时文件并替换目标文件
+func (p *pendingFile) commit() error {
+	if err := p.file.Close(); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", p.path, err)
+	}
+	if err := os.Rename(p.file.Name(), p.path); err != nil {
+		os.Remove(p.file.Name())
+		return fmt.Errorf("写入 %s 失败: %w", p.path, err)
+	}
+	p.done = true
+	return nil
+}
+
+// discard 未提交时关闭并删除临时文件
+func (p *pendingFile) discard() {
+	if p.done {
+		return
+	}
+	p.file.Close()
+	os.Remove(p.file.Name())
+}
+
+// RewrapDeliveryManifest 为新的接收者重新封装交付路径中加密的清单副本，内容不变；清单未加密时返回 encryptor.ErrNotEncrypted
+func (m *Manager) RewrapDeliveryManifest(deliveryPath string, keys *encryptor.Keyring, recipients []encryptor.Recipient) error {
+	manifestPath := filepath.Join(deliveryPath, manifestFile)
+	encrypted, err := isEncryptedFile(manifestPath)
+	if err != nil {
+		return err
+	}
+	if !encrypted {
+		return encryptor.ErrNotEncrypted
+	}
+	if _, err := encryptor.RewrapFile(manifestPath, keys, recipients); err != nil {
+		return fmt.Errorf("重新封装清单失败: %w", err)
+	}
+	log.Printf("ManifestManager: Rewrapped delivery manifest %s", manifestPath)
+	return nil
+}
+
+// LoadChain 读取工作区的清单链，不存在时返回空的清单链
+func (m *Manager) LoadChain(workspacePath string) (*types.ManifestChain, error) {
+	return loadChain(filepath.Join(workspacePath, manifestDir, chainFile))
+}
+
+// LoadDeliveryChain 读取随清单一起保存在交付路径中的清单链，不存在时返回空的清单链
+func (m *Manager) LoadDeliveryChain(deliveryPath string) (*types.ManifestChain, error) {
+	return loadChain(filepath.Join(deliveryPath, chainFile))
+}
+
+// loadChain 读取清单链文件
+func loadChain(chainPath string) (*types.ManifestChain, error) {
+	data, err := ioutil.ReadFile(chainPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &types.ManifestChain{}, nil
+		}
+		return nil, fmt.Errorf("读取清单链失败: %w", err)
+	}
+	var chain types.ManifestChain
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return nil, fmt.Errorf("%w: 清单链: %v", ErrManifestCorrupted, err)
+	}
+	return &chain, nil
+}
@@ -0,0 +1,78 @@
+package manifest_manager
+
+import (
+	"beanckup/backend/types"
+	"fmt"
+	"path/filepath"
+)
+
+// 清单中的路径
+// 保存的清单以相对于工作区根目录、以 / 分隔的路径为键，工作区移动到其他位置（或其他盘符、挂载点）后仍能对应到同一批文件；
+// 内存中的清单以绝对路径为键，读取时按工作区当前位置展开，保存与签名前再转换回相对路径。
+
+// relativePath 返回 path 相对于 root、以 / 分隔的路径，path 不在 root 之内时返回 ErrPathOutsideWorkspace
+func relativePath(root, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%w: %s（工作区 %s）", ErrPathOutsideWorkspace, path, root)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// StoredForm 返回清单保存时的形式：文件与目录的键及路径改为相对于 WorkspacePath 的路径
+// 返回的清单与文件记录都是副本，不修改内存中的清单；签名与清单链针对这一形式计算哈希
+func StoredForm(manifest *types.Manifest) (*types.Manifest, error) {
+	if manifest.WorkspacePath == "" {
+		return nil, fmt.Errorf("%w: 清单没有记录工作区路径", ErrPathOutsideWorkspace)
+	}
+	stored := *manifest
+	stored.SourceHash = ""
+	stored.Files = make(map[string]*types.FileInfo, len(manifest.Files))
+	for path, file := range manifest.Files {
+		key, err := relativePath(manifest.WorkspacePath, path)
+		if err != nil {
+			return nil, err
+		}
+		copied := *file
+		if copied.Path, err = relativePath(manifest.WorkspacePath, file.Path); err != nil {
+			return nil, err
+		}
+		stored.Files[key] = &copied
+	}
+	if manifest.Dirs != nil {
+		stored.Dirs = make(map[string]*types.DirInfo, len(manifest.Dirs))
+		for path, dir := range manifest.Dirs {
+			key, err := relativePath(manifest.WorkspacePath, path)
+			if err != nil {
+				return nil, err
+			}
+			copied := *dir
+			if copied.Path, err = relativePath(manifest.WorkspacePath, dir.Path); err != nil {
+				return nil, err
+			}
+			stored.Dirs[key] = &copied
+		}
+	}
+	RebuildHashIndex(&stored)
+	return &stored, nil
+}
+
+// reroot 将读取到的清单中的相对路径按 root 展开为绝对路径，并把 WorkspacePath 改为 root
+func reroot(manifest *types.Manifest, root string) {
+	files := make(map[string]*types.FileInfo, len(manifest.Files))
+	for key, file := range manifest.Files {
+		file.Path = filepath.Join(root, filepath.FromSlash(file.Path))
+		files[filepath.Join(root, filepath.FromSlash(key))] = file
+	}
+	manifest.Files = files
+	if manifest.Dirs != nil {
+		dirs := make(map[string]*types.DirInfo, len(manifest.Dirs))
+		for key, dir := range manifest.Dirs {
+			dir.Path = filepath.Join(root, filepath.FromSlash(dir.Path))
+			dirs[filepath.Join(root, filepath.FromSlash(key))] = dir
+		}
+		manifest.Dirs = dirs
+	}
+	manifest.WorkspacePath = root
+	RebuildHashIndex(manifest)
+}
@@ -0,0 +1,206 @@
+package manifest_manager
+
+import (
+	"beanckup/backend/signer"
+	"beanckup/backend/types"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// 清单结构版本与迁移
+// 每个较早的结构版本保留一份当时的结构定义，读取时先按清单记录的版本解码，再逐版本升级到 types.ManifestVersion；
+// 升级只在内存中进行，下一次交付保存新清单时才以当前版本写出。清单的签名针对保存的原始内容，
+// 因此迁移前按原版本的结构计算清单哈希，记录在 Manifest.SourceHash 中供签名校验使用。
+// 增加结构版本时：把当前的 types.Manifest 复制为新的快照（如 manifestV3），为它补上解码、哈希与升级函数，
+// 在 schemas 中插到当前版本之前，再修改 types.Manifest 与 types.ManifestVersion。
+
+// legacyVersion 最早的清单结构版本，没有记录版本的清单按此版本读取
+const legacyVersion = "1.0"
+
+// schema 清单结构的一个版本
+type schema struct {
+	version string
+	decode  func(doc *document) (any, error)               // 按该版本的结构解码
+	hash    func(manifest any) (string, error)             // 按该版本的结构计算清单哈希
+	upgrade func(doc *document, manifest any) (any, error) // 升级到下一版本，当前版本为 nil
+}
+
+// schemas 按顺序列出全部清单结构版本，最后一项为当前版本
+var schemas = []schema{
+	{version: legacyVersion, decode: decodeV1, hash: hashV1, upgrade: upgradeV1},
+	{version: types.ManifestVersion, decode: decodeCurrent, hash: hashCurrent},
+}
+
+// document 读取到的、尚未按结构版本解码的清单
+// JSON 格式中 body 为整个清单；紧凑格式中 body 为头部，文件与目录记录逐行读入 files 与 dirs
+// root 为读取工作区清单时的工作区路径，较早的清单没有记录工作区路径时用于把绝对路径迁移为相对路径
+type document struct {
+	version string
+	root    string
+	body    json.RawMessage
+	compact bool
+	files   map[string]*types.FileInfo
+	dirs    map[string]*types.DirInfo
+}
+
+// newDocument 读取清单记录的结构版本
+func newDocument(body json.RawMessage, compact bool) (*document, error) {
+	var header struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(body, &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrManifestCorrupted, err)
+	}
+	doc := &document{version: header.Version, body: body, compact: compact}
+	if compact {
+		doc.files = make(map[string]*types.FileInfo)
+	}
+	if doc.version == "" {
+		doc.version = legacyVersion
+	}
+	return doc, nil
+}
+
+// migrate 按清单记录的结构版本解码，并逐版本升级到当前版本；版本未知（例如由更新的程序生成）时返回 ErrUnsupportedVersion，
+// 升级失败时返回 ErrMigrationFailed
+func migrate(doc *document) (*types.Manifest, error) {
+	index := -1
+	for i, s := range schemas {
+		if s.version == doc.version {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("%w: %s（当前程序支持到 %s，可能由更新版本的程序生成）", ErrUnsupportedVersion, doc.version, types.ManifestVersion)
+	}
+
+	value, err := schemas[index].decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrManifestCorrupted, err)
+	}
+	sourceHash, err := schemas[index].hash(value)
+	if err != nil {
+		return nil, err
+	}
+	for i := index; schemas[i].upgrade != nil; i++ {
+		if value, err = schemas[i].upgrade(doc, value); err != nil {
+			return nil, fmt.Errorf("%w: 从版本 %s 迁移到 %s: %w", ErrMigrationFailed, schemas[i].version, schemas[i+1].version, err)
+		}
+		log.Printf("ManifestManager: Migrated manifest from version %s to %s", schemas[i].version, schemas[i+1].version)
+	}
+
+	manifest := value.(*types.Manifest)
+	manifest.SourceHash = sourceHash
+	return manifest, nil
+}
+
+// decodeCurrent 按当前版本的结构解码
+func decodeCurrent(doc *document) (any, error) {
+	var manifest types.Manifest
+	if err := json.Unmarshal(doc.body, &manifest); err != nil {
+		return nil, err
+	}
+	if doc.compact {
+		manifest.Files = doc.files
+		if doc.dirs != nil {
+			manifest.Dirs = doc.dirs
+		}
+		RebuildHashIndex(&manifest)
+	}
+	return &manifest, nil
+}
+
+// hashCurrent 按当前版本计算清单哈希
+func hashCurrent(value any) (string, error) {
+	return signer.ManifestHash(value.(*types.Manifest))
+}
+
+// manifestV1 结构版本 1.0 的清单（缩进的 JSON），字段与顺序保持当时的定义，用于解码与计算原始哈希
+// 文件与目录以绝对路径为键，没有记录工作区路径
+type manifestV1 struct {
+	Version     string                     `json:"version"`
+	CreatedAt   time.Time                  `json:"createdAt"`
+	SeriesID    string                     `json:"seriesId"`
+	EpisodeID   string                     `json:"episodeId"`
+	Files       map[string]*types.FileInfo `json:"files"`
+	Directories map[string]*types.DirInfo  `json:"directories"`
+	Metadata    map[string]interface{}     `json:"metadata"`
+	HashToFile  map[string]string          `json:"hashToFile"`
+	Dirs        map[string]*types.DirInfo  `json:"dirs"`
+}
+
+// decodeV1 按结构版本 1.0 解码，该版本只以 JSON 格式保存
+func decodeV1(doc *document) (any, error) {
+	if doc.compact {
+		return nil, fmt.Errorf("结构版本 %s 的清单不应为紧凑格式", legacyVersion)
+	}
+	var manifest manifestV1
+	if err := json.Unmarshal(doc.body, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// hashV1 按结构版本 1.0 的字段计算清单哈希
+func hashV1(value any) (string, error) {
+	unsigned := *value.(*manifestV1)
+	if unsigned.Files == nil {
+		unsigned.Files = map[string]*types.FileInfo{}
+	}
+	if unsigned.Dirs == nil {
+		unsigned.Dirs = map[string]*types.DirInfo{}
+	}
+	if unsigned.HashToFile == nil {
+		unsigned.HashToFile = map[string]string{}
+	}
+	return signer.ContentHash(&unsigned)
+}
+
+// upgradeV1 将结构版本 1.0 升级到当前版本：directories 并入 dirs（两者都有的目录以 dirs 为准），丢弃 metadata，
+// 绝对路径改为相对于读取时的工作区路径；该版本没有记录工作区路径，只能从工作区读取，路径不在工作区之内时迁移失败
+func upgradeV1(doc *document, value any) (any, error) {
+	old := value.(*manifestV1)
+	if doc.root == "" {
+		return nil, fmt.Errorf("%w: 结构版本 %s 的清单没有记录工作区路径", ErrPathOutsideWorkspace, legacyVersion)
+	}
+	if len(old.Metadata) > 0 {
+		log.Printf("ManifestManager: Dropping %d metadata entries not supported by manifest version %s", len(old.Metadata), types.ManifestVersion)
+	}
+
+	manifest := &types.Manifest{
+		Version:       types.ManifestVersion,
+		CreatedAt:     old.CreatedAt,
+		SeriesID:      old.SeriesID,
+		EpisodeID:     old.EpisodeID,
+		WorkspacePath: doc.root,
+		Files:         make(map[string]*types.FileInfo, len(old.Files)),
+		Dirs:          make(map[string]*types.DirInfo, len(old.Dirs)+len(old.Directories)),
+	}
+	for path, file := range old.Files {
+		key, err := relativePath(doc.root, path)
+		if err != nil {
+			return nil, err
+		}
+		if file.Path, err = relativePath(doc.root, file.Path); err != nil {
+			return nil, err
+		}
+		manifest.Files[key] = file
+	}
+	for _, dirs := range []map[string]*types.DirInfo{old.Directories, old.Dirs} {
+		for path, dir := range dirs {
+			key, err := relativePath(doc.root, path)
+			if err != nil {
+				return nil, err
+			}
+			if dir.Path, err = relativePath(doc.root, dir.Path); err != nil {
+				return nil, err
+			}
+			manifest.Dirs[key] = dir
+		}
+	}
+	RebuildHashIndex(manifest)
+	return manifest, nil
+}
@@ -0,0 +1,170 @@
+package manifest_manager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"beanckup/backend/signer"
+	"beanckup/backend/types"
+)
+
+// goldenKey testdata 中签名的清单都由这把密钥签署
+const goldenKey = "beanckup-sig-6kpsY-KcUgq-9VB7Ey7F-ZVHdq6-vnuSQh7qaRRG0iw"
+
+var goldenTime = time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)
+
+// TestMigrateGolden 读取各结构版本的清单样本，比对迁移后的清单与按原始内容计算的清单哈希，签名的清单再校验签名
+func TestMigrateGolden(t *testing.T) {
+	if filepath.Separator != '/' {
+		t.Skip("样本使用 Unix 风格的绝对路径")
+	}
+	tests := []struct {
+		name     string
+		file     string
+		root     string // 读取时的工作区路径
+		wantHash string
+		want     *types.Manifest
+	}{
+		{
+			// 早期版本写出的清单：缩进的 JSON，以绝对路径为键，没有签名、交付包与条目名
+			name:     "1.0 缩进 JSON",
+			file:     "v1.0.json",
+			root:     "/home/alice/docs",
+			wantHash: "4edaf12f8d1568b72b32326cc517550457ade9c9a1e06dcd24d4c31f9856afc8",
+			// 没有记录工作区路径，按读取时的工作区路径迁移为相对路径
+			want: &types.Manifest{
+				Version:       types.ManifestVersion,
+				CreatedAt:     goldenTime,
+				SeriesID:      "S20240301-0a1b2c3d",
+				EpisodeID:     "E001",
+				WorkspacePath: "/home/alice/docs",
+				Files: map[string]*types.FileInfo{
+					"notes.txt":        {Path: "notes.txt", Name: "notes.txt", Size: 12, ModTime: goldenTime, ContentHash: "aaaa", Status: "unchanged"},
+					"photos/cat-2.jpg": {Path: "photos/cat-2.jpg", Name: "cat-2.jpg", Size: 2048, ModTime: goldenTime, ContentHash: "bbbb", Status: "new"},
+					"photos/cat.jpg":   {Path: "photos/cat.jpg", Name: "cat.jpg", Size: 2048, ModTime: goldenTime, ContentHash: "bbbb", Status: "unchanged"},
+				},
+				// 哈希索引按现存文件重建，同一内容取路径最小的文件
+				HashToFile: map[string]string{"aaaa": "notes.txt", "bbbb": "photos/cat-2.jpg"},
+				// directories 并入 dirs，两者都有的目录以 dirs 为准；metadata 丢弃
+				Dirs: map[string]*types.DirInfo{
+					"photos": {Path: "photos", Name: "photos", ModTime: goldenTime, FileCount: 2, TotalSize: 4096},
+					"old":    {Path: "old", Name: "old", ModTime: goldenTime},
+				},
+			},
+		},
+		{
+			name:     "3.0 紧凑格式",
+			file:     "v3.0.zst",
+			root:     "/data/projects",
+			wantHash: "1ce8240e949f90f4dbb493f19f2eb1a0dc377182f3cee3ea20a93348f405f790",
+			want: &types.Manifest{
+				Version:       types.ManifestVersion,
+				CreatedAt:     goldenTime,
+				SeriesID:      "S20240301-0a1b2c3d",
+				EpisodeID:     "E004",
+				WorkspaceID:   "W20240301-deadbeef",
+				WorkspacePath: "/data/projects",
+				Files: map[string]*types.FileInfo{
+					"readme.md":   {Path: "readme.md", Name: "readme.md", Size: 40, ModTime: goldenTime, ContentHash: "eeee", Status: "modified", EpisodeID: "E004", EntryName: "readme.md"},
+					"src/main.go": {Path: "src/main.go", Name: "main.go", Size: 90, ModTime: goldenTime, ContentHash: "ffff", Status: "unchanged", EpisodeID: "E001", EntryName: "src/main.go"},
+				},
+				HashToFile: map[string]string{"eeee": "readme.md", "ffff": "src/main.go"},
+				Packages:   map[string]string{"E001": "S20240301-0a1b2c3d-E001.zip", "E004": "S20240301-0a1b2c3d-E004.zip"},
+				Dirs: map[string]*types.DirInfo{
+					"src": {Path: "src", Name: "src", ModTime: goldenTime, FileCount: 1, TotalSize: 90},
+				},
+				PrevHash: "2222",
+			},
+		},
+		{
+			// 开启保留元数据时记录的权限、属主与扩展属性
+			name:     "3.0 POSIX 元数据",
+			file:     "v3.0-posix.zst",
+			root:     "/data/projects",
+			wantHash: "46fbaf4d870f2085dd6d34bb998af1480082343f81c6f0d7fc9077f61dc173a8",
+			want: &types.Manifest{
+				Version:       types.ManifestVersion,
+				CreatedAt:     goldenTime,
+				SeriesID:      "S20240301-0a1b2c3d",
+				EpisodeID:     "E005",
+				WorkspaceID:   "W20240301-deadbeef",
+				WorkspacePath: "/data/projects",
+				Files: map[string]*types.FileInfo{
+					"bin/run.sh": {Path: "bin/run.sh", Name: "run.sh", Size: 64, ModTime: goldenTime, ContentHash: "1234", Status: "new", EpisodeID: "E005", EntryName: "bin/run.sh",
+						Posix: &types.PosixMeta{Mode: 0755 | uint32(os.ModeSetuid), UID: 0, GID: 50}},
+					"readme.md": {Path: "readme.md", Name: "readme.md", Size: 40, ModTime: goldenTime, ContentHash: "eeee", Status: "unchanged", EpisodeID: "E004", EntryName: "readme.md",
+						Posix: &types.PosixMeta{Mode: 0644, UID: 1000, GID: 1000, Xattrs: map[string][]byte{"user.tag": []byte("blue")}}},
+				},
+				HashToFile: map[string]string{"1234": "bin/run.sh", "eeee": "readme.md"},
+				Packages:   map[string]string{"E004": "S20240301-0a1b2c3d-E004.zip", "E005": "S20240301-0a1b2c3d-E005.zip"},
+				Dirs: map[string]*types.DirInfo{
+					"bin": {Path: "bin", Name: "bin", ModTime: goldenTime, FileCount: 1, TotalSize: 64,
+						Posix: &types.PosixMeta{Mode: 0750 | uint32(os.ModeDir), UID: 1000, GID: 1000}},
+				},
+				PrevHash: "3333",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			got, err := DecodeManifest(file, tt.root)
+			if err != nil {
+				t.Fatalf("DecodeManifest: %v", err)
+			}
+
+			if got.SourceHash != tt.wantHash {
+				t.Errorf("SourceHash = %s，应为 %s", got.SourceHash, tt.wantHash)
+			}
+			if got.Signature != nil {
+				publicKey, hash, err := signer.VerifyManifest(got)
+				if err != nil {
+					t.Fatalf("VerifyManifest: %v", err)
+				}
+				if publicKey != goldenKey || hash != tt.wantHash {
+					t.Errorf("VerifyManifest = %s, %s，应为 %s, %s", publicKey, hash, goldenKey, tt.wantHash)
+				}
+			}
+			got.Signature = nil
+			got.SourceHash = ""
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("迁移后的清单不符:\n got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMigrateUnknownVersion 结构版本未知的清单返回 ErrUnsupportedVersion
+func TestMigrateUnknownVersion(t *testing.T) {
+	_, err := DecodeManifest(strings.NewReader(`{"version": "9.0", "files": {}}`), "/data/projects")
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("err = %v，应为 ErrUnsupportedVersion", err)
+	}
+}
+
+func TestMigrateLegacyOutsideWorkspace(t *testing.T) {
+	if filepath.Separator != '/' {
+		t.Skip("testdata 中的路径为 POSIX 路径")
+	}
+	for _, root := range []string{"", "/home/bob"} {
+		file, err := os.Open(filepath.Join("testdata", "v1.0.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = DecodeManifest(file, root)
+		file.Close()
+		if !errors.Is(err, ErrMigrationFailed) || !errors.Is(err, ErrPathOutsideWorkspace) {
+			t.Errorf("root %q: err = %v，应为 ErrMigrationFailed 与 ErrPathOutsideWorkspace", root, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package manifest_manager
+
+import (
+	"beanckup/backend/types"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const workspaceFile = "workspace.json"
+
+// getWorkspaceIdentityPath 返回工作区标识文件的绝对路径
+func (m *Manager) getWorkspaceIdentityPath(workspacePath string) string {
+	return filepath.Join(workspacePath, manifestDir, workspaceFile)
+}
+
+// NewWorkspaceID 生成一个新的工作区标识：创建日期加随机后缀
+func NewWorkspaceID() string {
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	return "W" + time.Now().Format("20060102") + "-" + hex.EncodeToString(suffix)
+}
+
+// loadWorkspaceIdentity 读取工作区标识，不存在时返回 nil
+func (m *Manager) loadWorkspaceIdentity(workspacePath string) (*types.WorkspaceIdentity, error) {
+	data, err := os.ReadFile(m.getWorkspaceIdentityPath(workspacePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取工作区标识失败: %w", err)
+	}
+	var identity types.WorkspaceIdentity
+	if err := json.Unmarshal(data, &identity); err != nil || identity.ID == "" {
+		return nil, fmt.Errorf("工作区标识已损坏: %s", m.getWorkspaceIdentityPath(workspacePath))
+	}
+	return &identity, nil
+}
+
+// saveWorkspaceIdentity 保存工作区标识
+func (m *Manager) saveWorkspaceIdentity(workspacePath string, identity *types.WorkspaceIdentity) error {
+	data, err := json.MarshalIndent(identity, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化工作区标识失败: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(workspacePath, manifestDir), 0755); err != nil {
+		return fmt.Errorf("创建 .beanckup 目录失败: %w", err)
+	}
+	if err := os.WriteFile(m.getWorkspaceIdentityPath(workspacePath), data, 0644); err != nil {
+		return fmt.Errorf("写入工作区标识失败: %w", err)
+	}
+	return nil
+}
+
+// WorkspaceID 返回工作区标识，不存在时生成并保存到 .beanckup/workspace.json
+func (m *Manager) WorkspaceID(workspacePath string) (string, error) {
+	identity, err := m.loadWorkspaceIdentity(workspacePath)
+	if err != nil {
+		return "", err
+	}
+	if identity == nil {
+		identity = &types.WorkspaceIdentity{ID: NewWorkspaceID(), CreatedAt: time.Now()}
+		if err := m.saveWorkspaceIdentity(workspacePath, identity); err != nil {
+			return "", err
+		}
+		log.Printf("ManifestManager: Created workspace identity %s for %s", identity.ID, workspacePath)
+	}
+	return identity.ID, nil
+}
+
+// checkWorkspaceIdentity 确认工作区中的清单属于该工作区：清单记录的工作区标识必须与 .beanckup 中的标识一致
+// 标识文件丢失时按清单记录的标识恢复；清单没有记录标识（较早的清单）时不检查
+func (m *Manager) checkWorkspaceIdentity(workspacePath string, manifest *types.Manifest) error {
+	if manifest.WorkspaceID == "" {
+		return nil
+	}
+	identity, err := m.loadWorkspaceIdentity(workspacePath)
+	if err != nil {
+		return err
+	}
+	if identity == nil {
+		log.Printf("ManifestManager: Workspace identity missing, restoring %s from manifest", manifest.WorkspaceID)
+		return m.saveWorkspaceIdentity(workspacePath, &types.WorkspaceIdentity{ID: manifest.WorkspaceID, CreatedAt: time.Now()})
+	}
+	if identity.ID != manifest.WorkspaceID {
+		return fmt.Errorf("%w: 清单记录的工作区标识为 %s，工作区为 %s", ErrWorkspaceMismatch, manifest.WorkspaceID, identity.ID)
+	}
+	return nil
+}
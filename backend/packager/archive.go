@@ -0,0 +1,189 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"beanckup/backend/encryptor"
+	"beanckup/backend/throttle"
+	"beanckup/backend/types"
+	"beanckup/backend/worker"
+)
+
+// ArchiveWriter 归档写入器接口，按条目流式写入，不依赖外部程序
+type ArchiveWriter interface {
+	// 写入一个条目，内容从 r 中读取
+	AddFile(name string, info *types.FileInfo, r io.Reader) error
+
+	// 完成写入并关闭归档文件
+	Close() error
+}
+
+// zipArchiveWriter 基于标准库 archive/zip 的原生归档写入器
+type zipArchiveWriter struct {
+	file   *os.File
+	sealer *encryptor.Writer // 原生加密层，未加密时为 nil
+	writer *zip.Writer
+}
+
+// NewZipArchiveWriter 在 targetPath 创建一个新的 zip 归档，写入速度受 limiter 约束（nil 表示不限速）
+// recipients 不为空时归档经原生加密层为这些接收者加密后再写入文件，磁盘上不会出现明文
+// targetPath 已存在时返回 ErrArchiveExists，不会覆盖已有的交付包
+func NewZipArchiveWriter(targetPath string, limiter *throttle.Limiter, recipients []encryptor.Recipient) (ArchiveWriter, error) {
+	file, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrArchiveExists, targetPath)
+		}
+		return nil, fmt.Errorf("创建交付包失败: %w", err)
+	}
+	w := &zipArchiveWriter{file: file}
+	out := throttle.Writer(file, limiter)
+	if len(recipients) > 0 {
+		sealer, err := encryptor.NewWriter(out, recipients)
+		if err != nil {
+			file.Close()
+			os.Remove(targetPath)
+			return nil, err
+		}
+		w.sealer = sealer
+		out = sealer
+	}
+	w.writer = zip.NewWriter(out)
+	return w, nil
+}
+
+// AddFile 写入一个条目
+func (w *zipArchiveWriter) AddFile(name string, info *types.FileInfo, r io.Reader) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: info.ModTime,
+	}
+	entry, err := w.writer.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("创建归档条目失败 %s: %w", name, err)
+	}
+	if _, err := io.Copy(entry, r); err != nil {
+		return fmt.Errorf("写入归档条目失败 %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close 完成写入并关闭归档文件
+func (w *zipArchiveWriter) Close() error {
+	if err := w.writer.Close(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("完成归档失败: %w", err)
+	}
+	if w.sealer != nil {
+		if err := w.sealer.Close(); err != nil {
+			w.file.Close()
+			return fmt.Errorf("完成归档失败: %w", err)
+		}
+	}
+	return w.file.Close()
+}
+
+// ZipArchive 打开的 zip 交付包，原生加密的交付包（文件名以 encryptor.Suffix 结尾）在读取时按块解密
+type ZipArchive struct {
+	*zip.Reader
+	closer io.Closer
+}
+
+// OpenZipArchive 打开 zip 交付包，加密的交付包需要 keys 提供密码
+func OpenZipArchive(packagePath string, keys *encryptor.Keyring) (*ZipArchive, error) {
+	if strings.HasSuffix(packagePath, encryptor.Suffix) {
+		file, err := encryptor.OpenFile(packagePath, keys)
+		if err != nil {
+			return nil, err
+		}
+		reader, err := zip.NewReader(file, file.Size())
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &ZipArchive{Reader: reader, closer: file}, nil
+	}
+	archive, err := zip.OpenReader(packagePath)
+	if err != nil {
+		return nil, err
+	}
+	return &ZipArchive{Reader: &archive.Reader, closer: archive}, nil
+}
+
+// Close 关闭交付包
+func (a *ZipArchive) Close() error {
+	return a.closer.Close()
+}
+
+// WriteTasks 将哈希结果中需要物理备份的任务写入归档
+// 小文件直接使用内存中的 Data，不再重新读取磁盘；
+// ContentHash 为空的结果表示尚未计算哈希，写入时通过 tee 边读边算并回填，返回写入的原始数据量
+func (m *Manager) WriteTasks(writer ArchiveWriter, results []*types.WorkerResult, workspacePath string) (int64, error) {
+	var written int64
+	for _, result := range results {
+		if result.Error != nil || result.IsDuplicate {
+			continue
+		}
+
+		task := result.Task
+		name := EntryName(task.FileInfo.Path, workspacePath)
+		contentHash, err := m.writeTask(writer, name, task, result.ContentHash == "")
+		if err != nil {
+			return written, err
+		}
+		if contentHash != "" {
+			result.ContentHash = contentHash
+			task.FileInfo.ContentHash = contentHash
+		}
+
+		task.FileInfo.EntryName = name
+		written += task.FileInfo.Size
+		m.packedFiles++
+	}
+	return written, nil
+}
+
+// writeTask 写入单个任务，needHash 为 true 时返回写入过程中计算出的哈希
+func (m *Manager) writeTask(writer ArchiveWriter, name string, task *types.ProcessingTask, needHash bool) (string, error) {
+	var source io.Reader
+	if task.Type == types.TaskTypeSmallFile && task.Data != nil {
+		source = bytes.NewReader(task.Data)
+	} else {
+		path := task.Path
+		if path == "" {
+			path = task.FileInfo.Path
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("打开文件失败: %w", err)
+		}
+		defer file.Close()
+		source = throttle.Reader(file, m.readLimiter)
+	}
+
+	if !needHash {
+		return "", writer.AddFile(name, task.FileInfo, source)
+	}
+
+	hashingReader := worker.NewHashingReader(source)
+	if err := writer.AddFile(name, task.FileInfo, hashingReader); err != nil {
+		return "", err
+	}
+	return hashingReader.Sum(), nil
+}
+
+// EntryName 返回文件在交付包内的条目名：相对于工作区、使用 / 分隔
+func EntryName(filePath, workspacePath string) string {
+	relPath, err := filepath.Rel(workspacePath, filePath)
+	if err != nil {
+		relPath = filepath.Base(filePath)
+	}
+	return filepath.ToSlash(relPath)
+}
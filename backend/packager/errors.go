@@ -14,4 +14,7 @@ var (
 
 	// ErrOutputDirectoryNotFound 输出目录未找到
 	ErrOutputDirectoryNotFound = errors.New("输出目录未找到")
+
+	// ErrArchiveExists 交付包已存在，拒绝覆盖
+	ErrArchiveExists = errors.New("交付包已存在，拒绝覆盖")
 )
@@ -13,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"beanckup/backend/throttle"
 	"beanckup/backend/types"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
@@ -21,7 +22,7 @@ import (
 // Packager 打包器接口
 type Packager interface {
 	// 使用7zr.exe创建压缩包
-	CreateArchiveWith7zr(filesToPack []*types.FileInfo, targetPath string, workspacePath string, password string) error
+	CreateArchiveWith7zr(filesToPack []*types.FileInfo, targetPath string, workspacePath string, password []byte) error
 
 	// 获取打包进度
 	GetPackProgress() float64
@@ -37,6 +38,9 @@ type Manager struct {
 	packedFiles  int
 	totalFiles   int
 	ctx          context.Context
+
+	readLimiter  *throttle.Limiter
+	writeLimiter *throttle.Limiter
 }
 
 // NewManager 创建新的打包器
@@ -47,20 +51,31 @@ func NewManager() *Manager {
 	}
 }
 
+// SetLimiters 设置读取与写入限速器，nil 表示不限速
+// 注意：7zr 自行读写文件，不受限速器约束，只能通过后台模式降低其优先级
+func (m *Manager) SetLimiters(readLimiter, writeLimiter *throttle.Limiter) {
+	m.readLimiter = readLimiter
+	m.writeLimiter = writeLimiter
+}
+
+// WriteLimiter 返回写入限速器
+func (m *Manager) WriteLimiter() *throttle.Limiter {
+	return m.writeLimiter
+}
+
 // CreateArchiveWith7zr 使用7zr.exe创建压缩包
-func (m *Manager) CreateArchiveWith7zr(filesToPack []*types.FileInfo, targetPath string, workspacePath string, password string) error {
+// 7zr 的 a 命令会向已存在的压缩包追加条目，因此 targetPath 已存在时返回 ErrArchiveExists
+func (m *Manager) CreateArchiveWith7zr(filesToPack []*types.FileInfo, targetPath string, workspacePath string, password []byte) error {
 	if len(filesToPack) == 0 {
 		return fmt.Errorf("没有文件需要打包到 %s", filepath.Base(targetPath))
 	}
+	if _, err := os.Stat(targetPath); err == nil {
+		return fmt.Errorf("%w: %s", ErrArchiveExists, targetPath)
+	}
 
-	// 7zr.exe应该和主程序在同一目录下
-	executablePath, err := os.Executable()
+	sevenZipPath, err := m.Find7zr()
 	if err != nil {
-		return fmt.Errorf("无法获取程序路径: %w", err)
-	}
-	sevenZipPath := filepath.Join(filepath.Dir(executablePath), "7zr.exe")
-	if _, err := os.Stat(sevenZipPath); os.IsNotExist(err) {
-		return fmt.Errorf("关键组件丢失: 7zr.exe 未在程序目录找到")
+		return err
 	}
 
 	// 创建临时文件列表
@@ -72,8 +87,8 @@ func (m *Manager) CreateArchiveWith7zr(filesToPack []*types.FileInfo, targetPath
 
 	writer := bufio.NewWriter(tempFile)
 	for _, file := range filesToPack {
-		// 写入文件的绝对路径
-		if _, err := writer.WriteString(file.Path + "\n"); err != nil {
+		// 写入相对于工作区的路径，配合下方的工作目录，使压缩包内的条目名与原生写入器一致
+		if _, err := writer.WriteString(filepath.FromSlash(EntryName(file.Path, workspacePath)) + "\n"); err != nil {
 			tempFile.Close()
 			return fmt.Errorf("写入文件列表失败: %w", err)
 		}
@@ -88,14 +103,20 @@ func (m *Manager) CreateArchiveWith7zr(filesToPack []*types.FileInfo, targetPath
 		targetPath,            // 输出的压缩包完整路径
 		"@" + tempFile.Name(), // 从文件列表读取要压缩的文件
 	}
-	if password != "" {
-		args = append(args, "-p"+password, "-mhe=on") // 如果有密码，则添加密码并加密头部
+	if len(password) > 0 {
+		args = append(args, "-p", "-mhe=on") // 如果有密码，则从标准输入读取密码并加密头部
 	}
 
 	// 创建命令
 	cmd := exec.Command(sevenZipPath, args...)
 	// **核心修复**: 设置正确的工作目录，让压缩包内的目录结构是相对于工作区的
 	cmd.Dir = workspacePath
+	if len(password) > 0 {
+		// 创建压缩包时 7zr 会要求再次输入密码确认
+		if err := feedPassword(cmd, password, 2); err != nil {
+			return err
+		}
+	}
 
 	// 执行命令并捕获输出
 	output, err := cmd.CombinedOutput()
@@ -107,6 +128,164 @@ func (m *Manager) CreateArchiveWith7zr(filesToPack []*types.FileInfo, targetPath
 	return nil
 }
 
+// ExtractEntryWith7zr 使用7zr.exe将交付包中的单个条目解压到标准输出，返回其内容流
+// 调用方读取完毕后必须 Close，以等待 7zr 退出并获取其执行结果
+func (m *Manager) ExtractEntryWith7zr(archivePath, entryName string, password []byte) (io.ReadCloser, error) {
+	return m.extractWith7zr(archivePath, password, filepath.FromSlash(entryName))
+}
+
+// ExtractAllWith7zr 使用7zr.exe将交付包中的全部文件条目依次解压到标准输出，返回连续的内容流
+// 条目按 ListEntriesWith7zr 列出的顺序首尾相接，调用方按各条目的大小切分；
+// 固实压缩包只需解压一遍，避免逐个条目解压时每次都从头解压所在的数据块
+func (m *Manager) ExtractAllWith7zr(archivePath string, password []byte) (io.ReadCloser, error) {
+	return m.extractWith7zr(archivePath, password)
+}
+
+// extractWith7zr 启动 7zr 将指定条目（为空时为全部条目）解压到标准输出
+func (m *Manager) extractWith7zr(archivePath string, password []byte, entryNames ...string) (io.ReadCloser, error) {
+	sevenZipPath, err := m.Find7zr()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"e",   // 解压（不保留目录结构）
+		"-so", // 输出到标准输出
+		"-p",  // 从标准输入读取密码
+		archivePath,
+	}
+	args = append(args, entryNames...)
+	cmd := exec.Command(sevenZipPath, args...)
+	if err := feedPassword(cmd, password, 1); err != nil {
+		return nil, err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("创建7zr输出管道失败: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("启动7zr失败: %w", err)
+	}
+	return &extractReader{ReadCloser: stdout, cmd: cmd, stderr: &stderr}, nil
+}
+
+// ArchiveEntry 交付包中的一个文件条目及其解压后的大小
+type ArchiveEntry struct {
+	Name string
+	Size int64
+}
+
+// ListEntriesWith7zr 使用7zr.exe按压缩包内的顺序列出文件条目（不含目录）及其大小，条目名使用 / 分隔
+func (m *Manager) ListEntriesWith7zr(archivePath string, password []byte) ([]ArchiveEntry, error) {
+	sevenZipPath, err := m.Find7zr()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"l",    // 列出内容
+		"-slt", // 每个条目以 "键 = 值" 的形式逐行输出
+		"-p",   // 从标准输入读取密码
+		archivePath,
+	}
+	cmd := exec.Command(sevenZipPath, args...)
+	if err := feedPassword(cmd, password, 1); err != nil {
+		return nil, err
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("7zr执行失败: %w, 输出: %s", err, string(output))
+	}
+
+	// 技术信息以 "----------" 开始，之前的 Path 是压缩包自身；各条目之间以空行分隔
+	var entries []ArchiveEntry
+	var path string
+	var size int64
+	isDir := false
+	started := false
+	flush := func() {
+		if path != "" && !isDir {
+			entries = append(entries, ArchiveEntry{Name: filepath.ToSlash(path), Size: size})
+		}
+		path, size, isDir = "", 0, false
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case line == "----------":
+			started = true
+		case !started:
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "Path = "):
+			path = strings.TrimPrefix(line, "Path = ")
+		case strings.HasPrefix(line, "Size = "):
+			size, _ = strconv.ParseInt(strings.TrimPrefix(line, "Size = "), 10, 64)
+		case line == "Folder = +" || (strings.HasPrefix(line, "Attributes = ") && strings.Contains(line, "D")):
+			isDir = true
+		}
+	}
+	flush()
+	return entries, nil
+}
+
+// feedPassword 通过标准输入向 7zr 提供密码，命令行只传不带值的 -p，使 7zr 提示输入密码并从标准输入读取，
+// 避免密码出现在进程参数中被其他用户通过 ps 或 /proc/<pid>/cmdline 看到
+// 7zr 有控制终端时从终端而不是标准输入读取密码，因此命令在没有控制终端的新会话中启动
+// 必须在启动命令前调用：密码（每次一行，共 times 次）先写入管道缓冲区，写入后立即清零并关闭管道；
+// password 由调用方持有，调用方在命令启动后即可将其清零
+func feedPassword(cmd *exec.Cmd, password []byte, times int) error {
+	detachTerminal(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("创建7zr输入管道失败: %w", err)
+	}
+	defer stdin.Close()
+
+	input := make([]byte, 0, (len(password)+1)*times)
+	for i := 0; i < times; i++ {
+		input = append(input, password...)
+		input = append(input, '\n')
+	}
+	_, err = stdin.Write(input)
+	clear(input)
+	if err != nil {
+		return fmt.Errorf("向7zr写入密码失败: %w", err)
+	}
+	return nil
+}
+
+// extractReader 7zr 解压输出流，关闭时等待进程退出
+type extractReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *strings.Builder
+}
+
+// Close 关闭输出流并等待 7zr 退出
+func (r *extractReader) Close() error {
+	io.Copy(io.Discard, r.ReadCloser)
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("7zr执行失败: %w, 输出: %s", err, r.stderr.String())
+	}
+	return nil
+}
+
+// Find7zr 返回与主程序同目录下的 7zr.exe 路径
+func (m *Manager) Find7zr() (string, error) {
+	executablePath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("无法获取程序路径: %w", err)
+	}
+	sevenZipPath := filepath.Join(filepath.Dir(executablePath), "7zr.exe")
+	if _, err := os.Stat(sevenZipPath); os.IsNotExist(err) {
+		return "", fmt.Errorf("关键组件丢失: 7zr.exe 未在程序目录找到")
+	}
+	return sevenZipPath, nil
+}
+
 // createTempFileListWithAbsolutePaths 创建包含绝对路径的临时文件列表
 func (m *Manager) createTempFileListWithAbsolutePaths(filesToPack []*types.FileInfo, tempDir string) (string, error) {
 	// 创建临时文件
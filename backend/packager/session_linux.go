@@ -0,0 +1,16 @@
+//go:build linux
+
+package packager
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachTerminal 使命令在新会话中启动，脱离控制终端
+func detachTerminal(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+}
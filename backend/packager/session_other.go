@@ -0,0 +1,8 @@
+//go:build !linux
+
+package packager
+
+import "os/exec"
+
+// detachTerminal 当前平台的 7zr 从标准输入读取密码，无需脱离控制终端
+func detachTerminal(cmd *exec.Cmd) {}
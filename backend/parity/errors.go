@@ -0,0 +1,17 @@
+package parity
+
+import "errors"
+
+var (
+	// ErrInvalidRedundancy 冗余比例无效
+	ErrInvalidRedundancy = errors.New("冗余比例必须在 1 到 100 之间")
+
+	// ErrParityExists 恢复数据文件已存在
+	ErrParityExists = errors.New("恢复数据文件已存在，拒绝覆盖")
+
+	// ErrParityCorrupted 恢复数据文件已损坏
+	ErrParityCorrupted = errors.New("恢复数据文件已损坏")
+
+	// ErrUnrepairable 损坏超出恢复数据的修复能力
+	ErrUnrepairable = errors.New("损坏超出恢复数据的修复能力")
+)
@@ -0,0 +1,483 @@
+package parity
+
+import (
+	"beanckup/backend/throttle"
+	"beanckup/backend/types"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+const (
+	// Suffix 恢复数据文件的后缀，文件名为 <交付包文件名>.parity
+	Suffix = ".parity"
+
+	magic        = "BKPARITY"
+	version      = 1
+	minBlockSize = 64 * 1024 // 最小数据块大小
+	maxBlocks    = 32768     // 数据块数上限，超过时增大数据块
+	groupSize    = 100       // 每组的数据块数，组内按冗余比例生成恢复块
+)
+
+// header 恢复数据文件的头部，记录交付包的大小、校验和以及每个数据块与恢复块的哈希
+// 文件结构：magic | 头部长度（8 字节，小端） | 头部 JSON | 依次排列的恢复块
+type header struct {
+	Version         int      `json:"version"`
+	ArchiveName     string   `json:"archiveName"`
+	ArchiveSize     int64    `json:"archiveSize"`
+	ArchiveChecksum string   `json:"archiveChecksum"`
+	BlockSize       int      `json:"blockSize"`
+	GroupSize       int      `json:"groupSize"`
+	Redundancy      int      `json:"redundancy"`   // 冗余比例（百分比）
+	DataHashes      []string `json:"dataHashes"`   // 每个数据块（末块补零到整块）的 SHA-256
+	ParityHashes    []string `json:"parityHashes"` // 每个恢复块的 SHA-256
+}
+
+// group 一组数据块及其恢复块在各自序列中的位置
+type group struct {
+	firstData, dataCount     int
+	firstParity, parityCount int
+}
+
+// groups 按头部参数划分数据块分组；每组的恢复块数为数据块数乘以冗余比例后向上取整
+func (h *header) groups() []group {
+	var groups []group
+	parity := 0
+	for first := 0; first < len(h.DataHashes); first += h.GroupSize {
+		count := h.GroupSize
+		if first+count > len(h.DataHashes) {
+			count = len(h.DataHashes) - first
+		}
+		parityCount := (count*h.Redundancy + 99) / 100
+		groups = append(groups, group{first, count, parity, parityCount})
+		parity += parityCount
+	}
+	return groups
+}
+
+// Manager 为交付包生成 Reed-Solomon 恢复数据（类似 PAR2），并据此校验与修复交付包
+type Manager struct {
+	readLimiter  *throttle.Limiter
+	writeLimiter *throttle.Limiter
+	encoders     map[[2]int]reedsolomon.Encoder
+}
+
+// NewManager 创建新的恢复数据管理器
+func NewManager() *Manager {
+	return &Manager{encoders: make(map[[2]int]reedsolomon.Encoder)}
+}
+
+// SetLimiters 设置读写限速器
+func (m *Manager) SetLimiters(readLimiter, writeLimiter *throttle.Limiter) {
+	m.readLimiter = readLimiter
+	m.writeLimiter = writeLimiter
+}
+
+// encoder 返回指定数据块数与恢复块数的编码器
+func (m *Manager) encoder(dataCount, parityCount int) (reedsolomon.Encoder, error) {
+	key := [2]int{dataCount, parityCount}
+	if enc, ok := m.encoders[key]; ok {
+		return enc, nil
+	}
+	enc, err := reedsolomon.New(dataCount, parityCount)
+	if err != nil {
+		return nil, fmt.Errorf("创建纠删码编码器失败: %w", err)
+	}
+	m.encoders[key] = enc
+	return enc, nil
+}
+
+// Create 为交付包生成恢复数据文件 <archivePath>.parity，redundancy 为恢复数据占交付包大小的百分比
+// 交付包按数据块分组编码，每组最多能修复与恢复块数相同的损坏块；返回恢复数据文件路径
+func (m *Manager) Create(archivePath, checksum string, redundancy int) (string, error) {
+	if redundancy < 1 || redundancy > 100 {
+		return "", ErrInvalidRedundancy
+	}
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("读取交付包失败: %w", err)
+	}
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("读取交付包失败: %w", err)
+	}
+	defer archive.Close()
+
+	blockSize := int64(minBlockSize)
+	if info.Size() > blockSize*maxBlocks {
+		blockSize = (info.Size()/maxBlocks + 4095) / 4096 * 4096
+	}
+	blockCount := int((info.Size() + blockSize - 1) / blockSize)
+	h := &header{
+		Version:         version,
+		ArchiveName:     filepath.Base(archivePath),
+		ArchiveSize:     info.Size(),
+		ArchiveChecksum: checksum,
+		BlockSize:       int(blockSize),
+		GroupSize:       groupSize,
+		Redundancy:      redundancy,
+		DataHashes:      make([]string, blockCount),
+	}
+
+	// 先把恢复块写入临时文件，哈希全部算出后再与头部一起写入恢复数据文件
+	parityPath := archivePath + Suffix
+	staging, err := os.CreateTemp(filepath.Dir(archivePath), ".beanckup_parity_*")
+	if err != nil {
+		return "", fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(staging.Name())
+	defer staging.Close()
+
+	reader := throttle.Reader(archive, m.readLimiter)
+	for _, g := range h.groups() {
+		enc, err := m.encoder(g.dataCount, g.parityCount)
+		if err != nil {
+			return "", err
+		}
+		shards := make([][]byte, g.dataCount+g.parityCount)
+		for i := range shards {
+			shards[i] = make([]byte, blockSize)
+		}
+		for i := 0; i < g.dataCount; i++ {
+			if _, err := io.ReadFull(reader, shards[i]); err != nil && err != io.ErrUnexpectedEOF {
+				return "", fmt.Errorf("读取交付包失败: %w", err)
+			}
+			h.DataHashes[g.firstData+i] = blockHash(shards[i])
+		}
+		if err := enc.Encode(shards); err != nil {
+			return "", fmt.Errorf("生成恢复数据失败: %w", err)
+		}
+		for _, shard := range shards[g.dataCount:] {
+			h.ParityHashes = append(h.ParityHashes, blockHash(shard))
+			if _, err := staging.Write(shard); err != nil {
+				return "", fmt.Errorf("写入恢复数据失败: %w", err)
+			}
+		}
+	}
+	if _, err := staging.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("读取临时文件失败: %w", err)
+	}
+
+	out, err := os.OpenFile(parityPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return "", fmt.Errorf("%w: %s", ErrParityExists, parityPath)
+		}
+		return "", fmt.Errorf("创建恢复数据文件失败: %w", err)
+	}
+	if err := writeParityFile(throttle.Writer(out, m.writeLimiter), h, staging); err != nil {
+		out.Close()
+		os.Remove(parityPath)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(parityPath)
+		return "", fmt.Errorf("写入恢复数据失败: %w", err)
+	}
+
+	log.Printf("Parity: Created %s: %d data blocks of %d bytes, %d parity blocks (%d%%).", parityPath, blockCount, blockSize, len(h.ParityHashes), redundancy)
+	return parityPath, nil
+}
+
+// writeParityFile 写入 magic、头部与恢复块
+func writeParityFile(w io.Writer, h *header, parityBlocks io.Reader) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("序列化恢复数据头部失败: %w", err)
+	}
+	prefix := make([]byte, len(magic)+8)
+	copy(prefix, magic)
+	binary.LittleEndian.PutUint64(prefix[len(magic):], uint64(len(data)))
+	if _, err := w.Write(append(prefix, data...)); err != nil {
+		return fmt.Errorf("写入恢复数据失败: %w", err)
+	}
+	if _, err := io.Copy(w, parityBlocks); err != nil {
+		return fmt.Errorf("写入恢复数据失败: %w", err)
+	}
+	return nil
+}
+
+// parityFile 已打开的恢复数据文件
+type parityFile struct {
+	file       *os.File
+	header     *header
+	dataOffset int64 // 第一个恢复块在文件中的偏移
+}
+
+// openParity 打开并解析恢复数据文件
+func openParity(parityPath string) (*parityFile, error) {
+	f, err := os.Open(parityPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取恢复数据文件失败: %w", err)
+	}
+	prefix := make([]byte, len(magic)+8)
+	if _, err := io.ReadFull(f, prefix); err != nil || string(prefix[:len(magic)]) != magic {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s", ErrParityCorrupted, parityPath)
+	}
+	length := binary.LittleEndian.Uint64(prefix[len(magic):])
+	if length > 1<<30 {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s", ErrParityCorrupted, parityPath)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(f, data); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s", ErrParityCorrupted, parityPath)
+	}
+	var h header
+	if err := json.Unmarshal(data, &h); err != nil || h.Version != version || h.BlockSize <= 0 || h.GroupSize <= 0 {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s", ErrParityCorrupted, parityPath)
+	}
+	return &parityFile{file: f, header: &h, dataOffset: int64(len(prefix)) + int64(length)}, nil
+}
+
+// readBlock 从 offset 处读取一个块（末块与读取不完整的块补零到整块），读取失败时返回 nil
+func readBlock(r io.ReaderAt, offset int64, size int) []byte {
+	block := make([]byte, size)
+	if _, err := r.ReadAt(block, offset); err != nil && err != io.EOF {
+		return nil
+	}
+	return block
+}
+
+// blockHash 返回块的 SHA-256
+func blockHash(block []byte) string {
+	sum := sha256.Sum256(block)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify 按恢复数据校验交付包：逐块比对哈希，统计损坏的数据块与恢复块，并判断能否修复
+func (m *Manager) Verify(archivePath string) *types.ParityReport {
+	report, _ := m.check(archivePath, false)
+	return report
+}
+
+// Repair 按恢复数据修复交付包：重建损坏的数据块，写入临时文件并确认整个交付包的校验和后替换原文件；
+// 损坏的恢复块随后从完好的交付包重新生成并写回恢复数据文件
+func (m *Manager) Repair(archivePath string) (*types.ParityReport, error) {
+	return m.check(archivePath, true)
+}
+
+// check 校验交付包，repair 为 true 时修复损坏的数据块与恢复块
+func (m *Manager) check(archivePath string, repair bool) (*types.ParityReport, error) {
+	parityPath := archivePath + Suffix
+	report := &types.ParityReport{PackagePath: archivePath, ParityPath: parityPath, Problems: []string{}}
+	fail := func(err error) (*types.ParityReport, error) {
+		report.Problems = append(report.Problems, err.Error())
+		return report, err
+	}
+
+	pf, err := openParity(parityPath)
+	if err != nil {
+		return fail(err)
+	}
+	defer pf.file.Close()
+	h := pf.header
+	report.BlockCount = len(h.DataHashes)
+
+	// 交付包缺失时视为全部数据块损坏
+	var archive io.ReaderAt = bytes.NewReader(nil)
+	sizeMismatch := false
+	if f, err := os.Open(archivePath); err == nil {
+		defer f.Close()
+		archive = f
+		if info, err := f.Stat(); err == nil && info.Size() != h.ArchiveSize {
+			sizeMismatch = true
+			report.Problems = append(report.Problems, fmt.Sprintf("交付包大小不符: %d，应为 %d", info.Size(), h.ArchiveSize))
+		}
+	} else {
+		report.Problems = append(report.Problems, fmt.Sprintf("交付包不存在: %s", filepath.Base(archivePath)))
+	}
+
+	blockSize := h.BlockSize
+	groups := h.groups()
+	damagedData := make(map[int][]int) // 组序号到损坏的数据块（组内序号）
+	damagedParity := make(map[int][]int)
+	report.Repairable = true
+	for gi, g := range groups {
+		for i := 0; i < g.dataCount; i++ {
+			index := g.firstData + i
+			block := readBlock(archive, int64(index)*int64(blockSize), blockSize)
+			if block == nil || blockHash(block) != h.DataHashes[index] {
+				damagedData[gi] = append(damagedData[gi], i)
+			}
+		}
+		for j := 0; j < g.parityCount; j++ {
+			index := g.firstParity + j
+			block := readBlock(pf.file, pf.dataOffset+int64(index)*int64(blockSize), blockSize)
+			if block == nil || blockHash(block) != h.ParityHashes[index] {
+				damagedParity[gi] = append(damagedParity[gi], j)
+			}
+		}
+		report.DamagedBlocks += len(damagedData[gi])
+		report.DamagedParity += len(damagedParity[gi])
+		// 数据块完好时损坏的恢复块总能从数据块重新生成
+		if len(damagedData[gi]) > 0 && len(damagedData[gi])+len(damagedParity[gi]) > g.parityCount {
+			report.Repairable = false
+		}
+	}
+	if report.DamagedBlocks > 0 {
+		report.Problems = append(report.Problems, fmt.Sprintf("%d 个数据块损坏", report.DamagedBlocks))
+	}
+	if report.DamagedParity > 0 {
+		report.Problems = append(report.Problems, fmt.Sprintf("%d 个恢复块损坏", report.DamagedParity))
+	}
+	if !repair || (report.DamagedBlocks == 0 && report.DamagedParity == 0 && !sizeMismatch) {
+		return report, nil
+	}
+	if !report.Repairable {
+		return fail(ErrUnrepairable)
+	}
+
+	// 先修复交付包，再从修复后的交付包重新生成损坏的恢复块
+	if report.DamagedBlocks > 0 || sizeMismatch {
+		if err := m.rebuild(archivePath, archive, pf, groups, damagedData, damagedParity); err != nil {
+			return fail(err)
+		}
+	}
+	if report.DamagedParity > 0 {
+		if err := m.regenerateParity(archivePath, pf, groups, damagedParity); err != nil {
+			return fail(err)
+		}
+	}
+	report.Repaired = true
+	log.Printf("Parity: Repaired %s: %d data blocks rebuilt, %d parity blocks regenerated.", archivePath, report.DamagedBlocks, report.DamagedParity)
+	return report, nil
+}
+
+// regenerateParity 从交付包重新编码含有损坏恢复块的组，确认哈希与头部记录一致后写回恢复数据文件中对应的位置
+func (m *Manager) regenerateParity(archivePath string, pf *parityFile, groups []group, damagedParity map[int][]int) error {
+	h := pf.header
+	blockSize := h.BlockSize
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("读取交付包失败: %w", err)
+	}
+	defer archive.Close()
+	out, err := os.OpenFile(pf.file.Name(), os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("打开恢复数据文件失败: %w", err)
+	}
+
+	for gi, g := range groups {
+		if len(damagedParity[gi]) == 0 {
+			continue
+		}
+		shards := make([][]byte, g.dataCount+g.parityCount)
+		for i := 0; i < g.dataCount; i++ {
+			shards[i] = readBlock(archive, int64(g.firstData+i)*int64(blockSize), blockSize)
+			if shards[i] == nil || blockHash(shards[i]) != h.DataHashes[g.firstData+i] {
+				out.Close()
+				return ErrUnrepairable
+			}
+		}
+		for j := range shards[g.dataCount:] {
+			shards[g.dataCount+j] = make([]byte, blockSize)
+		}
+		enc, err := m.encoder(g.dataCount, g.parityCount)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		if err := enc.Encode(shards); err != nil {
+			out.Close()
+			return fmt.Errorf("生成恢复数据失败: %w", err)
+		}
+		for _, j := range damagedParity[gi] {
+			index := g.firstParity + j
+			if blockHash(shards[g.dataCount+j]) != h.ParityHashes[index] {
+				out.Close()
+				return ErrUnrepairable
+			}
+			if _, err := out.WriteAt(shards[g.dataCount+j], pf.dataOffset+int64(index)*int64(blockSize)); err != nil {
+				out.Close()
+				return fmt.Errorf("写入恢复数据失败: %w", err)
+			}
+		}
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("写入恢复数据失败: %w", err)
+	}
+	return nil
+}
+
+// rebuild 逐组写出修复后的交付包：未损坏的组原样复制，损坏的组用恢复块重建数据块；
+// 写入完成后确认整个交付包的校验和，再替换原文件
+func (m *Manager) rebuild(archivePath string, archive io.ReaderAt, pf *parityFile, groups []group, damagedData, damagedParity map[int][]int) error {
+	h := pf.header
+	blockSize := h.BlockSize
+	out, err := os.CreateTemp(filepath.Dir(archivePath), ".beanckup_repair_*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	tempPath := out.Name()
+	defer os.Remove(tempPath)
+
+	hasher := sha256.New()
+	writer := io.MultiWriter(throttle.Writer(out, m.writeLimiter), hasher)
+	remaining := h.ArchiveSize
+	for gi, g := range groups {
+		shards := make([][]byte, g.dataCount+g.parityCount)
+		for i := 0; i < g.dataCount; i++ {
+			shards[i] = readBlock(archive, int64(g.firstData+i)*int64(blockSize), blockSize)
+		}
+		if len(damagedData[gi]) > 0 {
+			for j := 0; j < g.parityCount; j++ {
+				shards[g.dataCount+j] = readBlock(pf.file, pf.dataOffset+int64(g.firstParity+j)*int64(blockSize), blockSize)
+			}
+			for _, i := range damagedData[gi] {
+				shards[i] = nil
+			}
+			for _, j := range damagedParity[gi] {
+				shards[g.dataCount+j] = nil
+			}
+			enc, err := m.encoder(g.dataCount, g.parityCount)
+			if err != nil {
+				out.Close()
+				return err
+			}
+			if err := enc.ReconstructData(shards); err != nil {
+				out.Close()
+				return fmt.Errorf("%w: %v", ErrUnrepairable, err)
+			}
+			for _, i := range damagedData[gi] {
+				if blockHash(shards[i]) != h.DataHashes[g.firstData+i] {
+					out.Close()
+					return ErrUnrepairable
+				}
+			}
+		}
+		for i := 0; i < g.dataCount && remaining > 0; i++ {
+			block := shards[i]
+			if int64(len(block)) > remaining {
+				block = block[:remaining]
+			}
+			if _, err := writer.Write(block); err != nil {
+				out.Close()
+				return fmt.Errorf("写入修复后的交付包失败: %w", err)
+			}
+			remaining -= int64(len(block))
+		}
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("写入修复后的交付包失败: %w", err)
+	}
+	if h.ArchiveChecksum != "" && hex.EncodeToString(hasher.Sum(nil)) != h.ArchiveChecksum {
+		return fmt.Errorf("%w: 修复后的校验和不符", ErrUnrepairable)
+	}
+	if err := os.Rename(tempPath, archivePath); err != nil {
+		return fmt.Errorf("替换交付包失败: %w", err)
+	}
+	return nil
+}
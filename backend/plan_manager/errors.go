@@ -0,0 +1,11 @@
+package plan_manager
+
+import "errors"
+
+var (
+	// ErrPlanNotFound 备份计划未找到
+	ErrPlanNotFound = errors.New("备份计划未找到")
+
+	// ErrPlanCorrupted 备份计划已损坏
+	ErrPlanCorrupted = errors.New("备份计划已损坏")
+)
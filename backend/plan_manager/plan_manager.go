@@ -0,0 +1,109 @@
+package plan_manager
+
+import (
+	"beanckup/backend/types"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	planDir    = ".beanckup/plans"
+	planSuffix = ".plan.json"
+)
+
+// Manager 负责备份计划的持久化：预处理生成计划，执行时按计划 ID 读取
+type Manager struct {
+	mu sync.Mutex
+}
+
+// NewManager 创建一个新的计划管理器
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// getPlanPath 返回计划文件的绝对路径
+func (m *Manager) getPlanPath(workspacePath, planID string) string {
+	return filepath.Join(workspacePath, filepath.FromSlash(planDir), planID+planSuffix)
+}
+
+// NewPlanID 生成一个新的计划 ID：创建时间加随机后缀
+func NewPlanID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// SavePlan 将计划保存到工作区的 .beanckup/plans 目录
+func (m *Manager) SavePlan(plan *types.BackupPlan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	planPath := m.getPlanPath(plan.WorkspacePath, plan.ID)
+	if err := os.MkdirAll(filepath.Dir(planPath), 0755); err != nil {
+		return fmt.Errorf("创建计划目录失败: %w", err)
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化计划失败: %w", err)
+	}
+	if err := os.WriteFile(planPath, data, 0644); err != nil {
+		return fmt.Errorf("写入计划失败: %w", err)
+	}
+
+	log.Printf("PlanManager: Saved plan %s to %s", plan.ID, planPath)
+	return nil
+}
+
+// LoadPlan 读取工作区中的计划
+func (m *Manager) LoadPlan(workspacePath, planID string) (*types.BackupPlan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if planID == "" || strings.ContainsAny(planID, `/\`) {
+		return nil, fmt.Errorf("%w: %q", ErrPlanNotFound, planID)
+	}
+	data, err := os.ReadFile(m.getPlanPath(workspacePath, planID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrPlanNotFound, planID)
+		}
+		return nil, fmt.Errorf("读取计划失败: %w", err)
+	}
+
+	var plan types.BackupPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPlanCorrupted, err)
+	}
+	return &plan, nil
+}
+
+// ClearPlans 删除工作区中的所有计划
+// 一次备份执行完成后清单已更新，之前生成的计划都已失效
+func (m *Manager) ClearPlans(workspacePath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir := filepath.Join(workspacePath, filepath.FromSlash(planDir))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("读取计划目录失败: %w", err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), planSuffix) {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package resource_manager
+
+import (
+	"log"
+	"time"
+
+	"beanckup/backend/types"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+const (
+	minWorkerCount = 1
+
+	sampleInterval = 2 * time.Second // 采样周期
+
+	memoryPressurePercent = 10.0 // 可用内存低于该百分比视为内存压力
+	cpuSaturatedPercent   = 90.0 // CPU 使用率高于该百分比视为饱和
+	throughputGainRatio   = 1.05 // 扩容后吞吐至少提升 5% 才认为扩容有效
+	holdIntervals         = 5    // 扩容无效回退后，保持规模的采样周期数
+)
+
+// PoolController 可在运行中调整规模的工作池
+type PoolController interface {
+	WorkerCount() int
+	Resize(workerCount int) error
+	RecordDecision(decision types.ScalingDecision)
+}
+
+// Autoscaler 在任务运行期间周期性采样 CPU、内存压力和磁盘吞吐，动态调整工作池规模
+// 策略为爬山法：吞吐仍在随规模增长时继续扩容；扩容后吞吐不再提升则回退并保持一段时间；
+// 出现内存压力或 CPU 饱和时优先缩容
+type Autoscaler struct {
+	pool       PoolController
+	minWorkers int
+	maxWorkers int
+	stop       chan struct{}
+	done       chan struct{}
+
+	lastDiskBytes  uint64
+	lastSampleTime time.Time
+	lastThroughput float64
+	lastAction     int // +1 扩容，-1 缩容，0 保持
+	hold           int
+}
+
+// StartAutoscaler 为工作池启动自适应调整，任务结束时需调用 Stop
+func (m *Manager) StartAutoscaler(pool PoolController) *Autoscaler {
+	a := &Autoscaler{
+		pool:       pool,
+		minWorkers: minWorkerCount,
+		maxWorkers: m.MaxWorkerCount(),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	a.lastDiskBytes, _ = diskBytes()
+	a.lastSampleTime = time.Now()
+	cpu.Percent(0, false) // 建立 CPU 使用率的采样基准
+
+	log.Printf("ResourceManager: Autoscaler started with %d workers (range %d-%d).", pool.WorkerCount(), a.minWorkers, a.maxWorkers)
+	go a.run()
+	return a
+}
+
+// Stop 停止自适应调整
+func (a *Autoscaler) Stop() {
+	close(a.stop)
+	<-a.done
+	log.Printf("ResourceManager: Autoscaler stopped with %d workers.", a.pool.WorkerCount())
+}
+
+// run 采样主循环
+func (a *Autoscaler) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+			a.tick()
+		}
+	}
+}
+
+// tick 采样一次并按需调整规模
+func (a *Autoscaler) tick() {
+	cpuPercent, memAvailable, throughput := a.sample()
+	current := a.pool.WorkerCount()
+	target, reason := a.decide(current, cpuPercent, memAvailable, throughput)
+	a.lastThroughput = throughput
+
+	if target < a.minWorkers {
+		target = a.minWorkers
+	}
+	if target > a.maxWorkers {
+		target = a.maxWorkers
+	}
+	if target == current {
+		a.lastAction = 0
+		return
+	}
+
+	if err := a.pool.Resize(target); err != nil {
+		log.Printf("ResourceManager: Failed to resize worker pool to %d: %v", target, err)
+		return
+	}
+	if target > current {
+		a.lastAction = 1
+	} else {
+		a.lastAction = -1
+	}
+
+	decision := types.ScalingDecision{
+		Time:            time.Now(),
+		From:            current,
+		To:              target,
+		Reason:          reason,
+		CPUPercent:      cpuPercent,
+		MemoryAvailable: memAvailable,
+		DiskThroughput:  throughput,
+	}
+	a.pool.RecordDecision(decision)
+	log.Printf("ResourceManager: Worker pool %d -> %d (%s). CPU %.1f%%, memory available %.1f%%, disk %.2f MB/s.",
+		current, target, reason, cpuPercent, memAvailable, throughput/1024/1024)
+}
+
+// decide 根据采样结果给出目标规模及原因
+func (a *Autoscaler) decide(current int, cpuPercent, memAvailable, throughput float64) (int, string) {
+	switch {
+	case memAvailable < memoryPressurePercent:
+		return current - 1, "内存压力"
+	case cpuPercent > cpuSaturatedPercent:
+		return current - 1, "CPU饱和"
+	case a.lastAction > 0 && throughput < a.lastThroughput*throughputGainRatio:
+		a.hold = holdIntervals
+		return current - 1, "扩容后吞吐未提升，回退"
+	case a.hold > 0:
+		a.hold--
+		return current, ""
+	default:
+		return current + 1, "资源充裕，尝试扩容"
+	}
+}
+
+// sample 采样 CPU 使用率、可用内存百分比和自上次采样以来的磁盘吞吐 (字节/秒)
+func (a *Autoscaler) sample() (cpuPercent, memAvailable, throughput float64) {
+	if percents, err := cpu.Percent(0, false); err == nil && len(percents) > 0 {
+		cpuPercent = percents[0]
+	}
+
+	memAvailable = 100
+	if vmstat, err := mem.VirtualMemory(); err == nil && vmstat.Total > 0 {
+		memAvailable = float64(vmstat.Available) / float64(vmstat.Total) * 100
+	}
+
+	now := time.Now()
+	if total, err := diskBytes(); err == nil {
+		if elapsed := now.Sub(a.lastSampleTime).Seconds(); elapsed > 0 && total >= a.lastDiskBytes {
+			throughput = float64(total-a.lastDiskBytes) / elapsed
+		}
+		a.lastDiskBytes = total
+	}
+	a.lastSampleTime = now
+	return cpuPercent, memAvailable, throughput
+}
+
+// diskBytes 返回所有磁盘累计读写的字节数
+// 部分平台会同时列出磁盘及其分区，总数会被放大，但只用于前后比较，不影响判断
+func diskBytes() (uint64, error) {
+	counters, err := disk.IOCounters()
+	if err != nil {
+		return 0, err
+	}
+	var total uint64
+	for _, counter := range counters {
+		total += counter.ReadBytes + counter.WriteBytes
+	}
+	return total, nil
+}
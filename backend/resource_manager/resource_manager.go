@@ -85,24 +85,22 @@ func (m *Manager) GetResourceInfo() *types.ResourceInfo {
 	return m.lastResourceInfo
 }
 
-// GetOptimalWorkerCount 获取最优工作协程数
-func (m *Manager) GetOptimalWorkerCount() int {
-	cpuCount := runtime.NumCPU()
-
-	// 根据CPU核心数确定工作协程数
-	// 通常设置为CPU核心数的1-2倍
-	workerCount := cpuCount * 2
+// InitialWorkerCount 返回工作池的起步规模
+// 机械硬盘和网络共享在并发读取时吞吐反而下降，因此保守起步，由 Autoscaler 按实测吞吐扩容
+func (m *Manager) InitialWorkerCount() int {
+	return minWorkerCount + 1
+}
 
-	// 限制最大工作协程数
-	if workerCount > 16 {
-		workerCount = 16
+// MaxWorkerCount 返回工作池规模的上限
+// 网络共享等高延迟存储需要较多并发来掩盖延迟，上限按 CPU 核心数放宽
+func (m *Manager) MaxWorkerCount() int {
+	workerCount := runtime.NumCPU() * 4
+	if workerCount > 32 {
+		workerCount = 32
 	}
-
-	// 确保至少有2个工作协程
-	if workerCount < 2 {
-		workerCount = 2
+	if workerCount < minWorkerCount+1 {
+		workerCount = minWorkerCount + 1
 	}
-
 	return workerCount
 }
 
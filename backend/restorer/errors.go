@@ -0,0 +1,20 @@
+package restorer
+
+import "errors"
+
+var (
+	// ErrNoLocation 文件缺少交付包信息
+	ErrNoLocation = errors.New("文件缺少交付包信息")
+
+	// ErrPackageNotFound 交付包未找到
+	ErrPackageNotFound = errors.New("交付包未找到")
+
+	// ErrEntryNotFound 交付包中未找到条目
+	ErrEntryNotFound = errors.New("交付包中未找到条目")
+
+	// ErrChecksumMismatch 还原内容校验失败
+	ErrChecksumMismatch = errors.New("还原内容校验失败")
+
+	// ErrUnsafePath 条目路径不安全
+	ErrUnsafePath = errors.New("条目路径不安全")
+)
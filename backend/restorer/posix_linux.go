@@ -0,0 +1,47 @@
+//go:build linux
+
+package restorer
+
+import (
+	"beanckup/backend/types"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"golang.org/x/sys/unix"
+)
+
+// applyPosix 恢复文件或目录的权限、属主与扩展属性（包括 ACL），不跟随符号链接
+// 恢复属主以及 security.*、trusted.* 等命名空间的扩展属性需要 root 权限，权限不足时跳过这些项
+func applyPosix(path string, meta *types.PosixMeta) error {
+	if meta == nil {
+		return nil
+	}
+	privileged := os.Geteuid() == 0
+	if privileged {
+		if err := unix.Lchown(path, meta.UID, meta.GID); err != nil {
+			return fmt.Errorf("恢复属主失败: %w", err)
+		}
+	}
+
+	names := make([]string, 0, len(meta.Xattrs))
+	for name := range meta.Xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := unix.Lsetxattr(path, name, meta.Xattrs[name], 0); err != nil {
+			if !privileged && (errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES)) {
+				continue
+			}
+			return fmt.Errorf("恢复扩展属性 %s 失败: %w", name, err)
+		}
+	}
+
+	// 修改属主会清除 setuid、setgid 位，因此最后设置权限
+	if err := unix.Chmod(path, meta.Mode); err != nil {
+		return fmt.Errorf("恢复权限失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package restorer
+
+import "beanckup/backend/types"
+
+// applyPosix 当前平台尚未实现，不恢复权限、属主与扩展属性
+func applyPosix(path string, meta *types.PosixMeta) error {
+	return nil
+}
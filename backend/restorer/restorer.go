@@ -0,0 +1,281 @@
+package restorer
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"beanckup/backend/encryptor"
+	"beanckup/backend/packager"
+	"beanckup/backend/types"
+	"beanckup/backend/worker"
+)
+
+// Manager 还原器：根据交付路径中的清单，从交付包中取出文件内容并校验
+type Manager struct {
+	packager *packager.Manager
+}
+
+// NewManager 创建新的还原器
+func NewManager() *Manager {
+	return &Manager{
+		packager: packager.NewManager(),
+	}
+}
+
+// session 一次还原过程，缓存已打开的 zip 交付包
+type session struct {
+	packager     *packager.Manager
+	manifest     *types.Manifest
+	deliveryPath string
+	targetPath   string
+	keyring      *encryptor.Keyring
+	archives     map[string]*packager.ZipArchive
+}
+
+// RestoreFiles 将清单中的文件还原到 targetPath 下，保持相对于工作区的目录结构
+// paths 为空时还原全部文件，否则只还原路径（或条目名）等于或位于其中某一项之下的文件；
+// 单个文件失败不影响其余文件，失败原因记录在结果中；keyring 提供加密交付包的密码
+func (m *Manager) RestoreFiles(manifest *types.Manifest, deliveryPath, targetPath string, paths []string, keyring *encryptor.Keyring) *types.RestoreResult {
+	s := &session{
+		packager:     m.packager,
+		manifest:     manifest,
+		deliveryPath: deliveryPath,
+		targetPath:   targetPath,
+		keyring:      keyring,
+		archives:     make(map[string]*packager.ZipArchive),
+	}
+	defer s.close()
+
+	keys := make([]string, 0, len(manifest.Files))
+	for key, file := range manifest.Files {
+		if selected(key, file, paths) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := &types.RestoreResult{Errors: []string{}}
+	for _, key := range keys {
+		file := manifest.Files[key]
+		dest := filepath.Join(targetPath, s.relativePath(file))
+		if err := s.restoreFile(file, dest); err != nil {
+			log.Printf("Restorer: Failed to restore %s: %v", key, err)
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		result.RestoredCount++
+		result.TotalSize += file.Size
+		// 内容已还原，权限等元数据恢复失败只记录原因
+		if err := applyPosix(dest, file.Posix); err != nil {
+			log.Printf("Restorer: Failed to restore metadata of %s: %v", key, err)
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+	s.restoreDirs(paths, result)
+	log.Printf("Restorer: Restored %d files (%d bytes) and %d directories, %d failed.", result.RestoredCount, result.TotalSize, result.DirCount, len(result.Errors))
+	return result
+}
+
+// restoreDirs 按清单中的目录记录创建范围内的目录（包括空目录），并还原目录的修改时间与权限等元数据
+// 在全部文件写入之后进行，避免写入文件再次改变目录的修改时间；范围按目录的绝对路径或相对于工作区的路径匹配
+func (s *session) restoreDirs(paths []string, result *types.RestoreResult) {
+	if s.manifest.WorkspacePath == "" {
+		return
+	}
+	keys := make([]string, 0, len(s.manifest.Dirs))
+	for key := range s.manifest.Dirs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var created []string
+	for _, key := range keys {
+		dir := s.manifest.Dirs[key]
+		rel, err := filepath.Rel(s.manifest.WorkspacePath, dir.Path)
+		if err != nil || !filepath.IsLocal(rel) {
+			if matches(paths, key) {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", key, ErrUnsafePath))
+			}
+			continue
+		}
+		if !matches(paths, key, filepath.ToSlash(rel)) {
+			continue
+		}
+		dest := filepath.Join(s.targetPath, rel)
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			log.Printf("Restorer: Failed to create directory %s: %v", key, err)
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: 创建目录失败: %v", key, err))
+			continue
+		}
+		created = append(created, key)
+		result.DirCount++
+	}
+	// 子目录的创建会改变上级目录的修改时间，因此全部创建后再设置；
+	// 由深到浅处理，避免先收紧上级目录的权限后无法访问子目录
+	for i := len(created) - 1; i >= 0; i-- {
+		key := created[i]
+		dir := s.manifest.Dirs[key]
+		rel, _ := filepath.Rel(s.manifest.WorkspacePath, dir.Path)
+		dest := filepath.Join(s.targetPath, rel)
+		if err := applyPosix(dest, dir.Posix); err != nil {
+			log.Printf("Restorer: Failed to restore metadata of directory %s: %v", key, err)
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", key, err))
+		}
+		if err := os.Chtimes(dest, dir.ModTime, dir.ModTime); err != nil {
+			log.Printf("Restorer: Failed to restore modification time of directory %s: %v", key, err)
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: 设置修改时间失败: %v", key, err))
+		}
+	}
+}
+
+// selected 判断文件是否在要还原的范围内
+func selected(key string, file *types.FileInfo, paths []string) bool {
+	return matches(paths, key, file.EntryName)
+}
+
+// matches 判断任一候选路径是否等于或位于 paths 中某一项之下，paths 为空时全部匹配
+func matches(paths []string, candidates ...string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		p = strings.TrimRight(p, `/\`)
+		for _, candidate := range candidates {
+			if candidate == p || strings.HasPrefix(candidate, p+"/") || strings.HasPrefix(candidate, p+string(filepath.Separator)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// relativePath 返回文件相对于工作区的路径
+// 重复文件的条目名指向其内容来源，因此优先根据清单记录的工作区路径计算
+func (s *session) relativePath(file *types.FileInfo) string {
+	if s.manifest.WorkspacePath != "" {
+		if rel, err := filepath.Rel(s.manifest.WorkspacePath, file.Path); err == nil {
+			return rel
+		}
+	}
+	return filepath.FromSlash(file.EntryName)
+}
+
+// restoreFile 将单个文件还原到 dest：先写入临时文件，全部校验通过后再替换为目标文件
+// 分卷文件依次读取各分卷并拼接，逐卷校验分卷哈希，最后校验整个文件的哈希
+func (s *session) restoreFile(file *types.FileInfo, dest string) error {
+	if file.EpisodeID == "" || file.EntryName == "" {
+		return ErrNoLocation
+	}
+	if rel, err := filepath.Rel(s.targetPath, dest); err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("%w: %s", ErrUnsafePath, file.Path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	out, err := os.CreateTemp(filepath.Dir(dest), ".beanckup_restore_*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	tempPath := out.Name()
+	defer os.Remove(tempPath)
+
+	fileHasher := worker.NewHashingReader(nil)
+	if len(file.Parts) > 0 {
+		for _, part := range file.Parts {
+			if err := s.copyEntry(out, part.EpisodeID, part.EntryName, fileHasher, part.Size, part.Hash); err != nil {
+				out.Close()
+				return fmt.Errorf("分卷 %d: %w", part.Index, err)
+			}
+		}
+	} else if err := s.copyEntry(out, file.EpisodeID, file.EntryName, fileHasher, file.Size, ""); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+
+	if fileHasher.Size() != file.Size || (file.ContentHash != "" && fileHasher.Sum() != file.ContentHash) {
+		return ErrChecksumMismatch
+	}
+	if err := os.Rename(tempPath, dest); err != nil {
+		return fmt.Errorf("替换目标文件失败: %w", err)
+	}
+	os.Chtimes(dest, file.ModTime, file.ModTime)
+	return nil
+}
+
+// copyEntry 将交付包中的一个条目追加写入 out，同时累积整个文件的哈希；
+// expectedHash 非空时校验该条目自身的哈希与大小
+func (s *session) copyEntry(out io.Writer, episodeID, entryName string, fileHasher *worker.HashingReader, expectedSize int64, expectedHash string) error {
+	entry, err := s.openEntry(episodeID, entryName)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+
+	fileHasher.Continue(entry)
+	entryHasher := worker.NewHashingReader(fileHasher)
+	if _, err := io.Copy(out, entryHasher); err != nil {
+		return fmt.Errorf("读取条目失败 %s: %w", entryName, err)
+	}
+	if expectedHash != "" && (entryHasher.Size() != expectedSize || entryHasher.Sum() != expectedHash) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// openEntry 打开分集交付包中的一个条目
+func (s *session) openEntry(episodeID, entryName string) (io.ReadCloser, error) {
+	name, ok := s.manifest.Packages[episodeID]
+	if !ok {
+		return nil, fmt.Errorf("%w: 分集 %s", ErrPackageNotFound, episodeID)
+	}
+	packagePath := filepath.Join(s.deliveryPath, name)
+	if _, err := os.Stat(packagePath); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, packagePath)
+	}
+
+	if strings.HasSuffix(name, ".7z") {
+		password := s.keyring.Password()
+		defer clear(password)
+		return s.packager.ExtractEntryWith7zr(packagePath, entryName, password)
+	}
+
+	archive, err := s.openZip(packagePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range archive.File {
+		if f.Name == entryName {
+			return f.Open()
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, entryName)
+}
+
+// openZip 打开并缓存 zip 交付包，原生加密的交付包读取时按块解密
+func (s *session) openZip(packagePath string) (*packager.ZipArchive, error) {
+	if archive, ok := s.archives[packagePath]; ok {
+		return archive, nil
+	}
+	archive, err := packager.OpenZipArchive(packagePath, s.keyring)
+	if err != nil {
+		return nil, fmt.Errorf("打开交付包失败: %w", err)
+	}
+	s.archives[packagePath] = archive
+	return archive, nil
+}
+
+// close 关闭所有已打开的交付包
+func (s *session) close() {
+	for _, archive := range s.archives {
+		archive.Close()
+	}
+}
@@ -0,0 +1,20 @@
+package series_manager
+
+import "errors"
+
+var (
+	// ErrSeriesCorrupted 系列登记已损坏
+	ErrSeriesCorrupted = errors.New("系列登记已损坏")
+
+	// ErrSeriesNotFound 系列登记未找到
+	ErrSeriesNotFound = errors.New("系列登记未找到")
+
+	// ErrEpisodeNotFound 分集未找到
+	ErrEpisodeNotFound = errors.New("分集未找到")
+
+	// ErrInvalidTransition 不允许的分集状态变化
+	ErrInvalidTransition = errors.New("不允许的分集状态变化")
+
+	// ErrInvalidNamingTemplate 无效的命名模板
+	ErrInvalidNamingTemplate = errors.New("无效的命名模板")
+)
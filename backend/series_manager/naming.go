@@ -0,0 +1,49 @@
+package series_manager
+
+import (
+	"beanckup/backend/types"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultNamingTemplate 默认的交付包命名模板
+const DefaultNamingTemplate = "{series}-{seq}-{timestamp}"
+
+// 命名模板中可用的占位符
+const (
+	placeholderSeries    = "{series}"    // 系列 ID
+	placeholderSequence  = "{seq}"       // 分集序号，跨运行单调递增，补零到 4 位
+	placeholderTimestamp = "{timestamp}" // 本次运行开始的时间，格式 20060102-150405
+)
+
+// ValidateNamingTemplate 校验命名模板：必须包含 {seq} 以保证名称不重复，且渲染结果必须是合法的文件名
+func ValidateNamingTemplate(template string) error {
+	if !strings.Contains(template, placeholderSequence) {
+		return fmt.Errorf("%w: 必须包含 %s", ErrInvalidNamingTemplate, placeholderSequence)
+	}
+	rest := strings.NewReplacer(placeholderSeries, "", placeholderSequence, "", placeholderTimestamp, "").Replace(template)
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("%w: 未知的占位符: %s", ErrInvalidNamingTemplate, template)
+	}
+	if strings.ContainsAny(rest, `/\:*?"<>|`) || strings.TrimSpace(rest) != rest {
+		return fmt.Errorf("%w: 包含文件名中不允许的字符: %s", ErrInvalidNamingTemplate, template)
+	}
+	return nil
+}
+
+// NextEpisode 为系列分配下一个分集，返回全局唯一的分集 ID 与按系列的命名模板生成的交付包名称（不含扩展名）
+// 序号跨运行单调递增，系列 ID 保证全局唯一；startedAt 为本次运行开始的时间
+func NextEpisode(series *types.Series, startedAt time.Time) (string, string) {
+	series.Sequence++
+	template := series.NamingTemplate
+	if template == "" {
+		template = DefaultNamingTemplate
+	}
+	name := strings.NewReplacer(
+		placeholderSeries, series.ID,
+		placeholderSequence, fmt.Sprintf("%04d", series.Sequence),
+		placeholderTimestamp, startedAt.Format("20060102-150405"),
+	).Replace(template)
+	return fmt.Sprintf("%s-E%04d", series.ID, series.Sequence), name
+}
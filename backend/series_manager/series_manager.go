@@ -0,0 +1,179 @@
+package series_manager
+
+import (
+	"beanckup/backend/types"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	seriesDir  = ".beanckup"
+	seriesFile = "series.json"
+)
+
+// transitions 分集生命周期中允许的状态变化
+// 失败的分集可以重新打包或清理，定期校验再次通过时恢复为已校验；已交付的分集在校验发现损坏时变为失败
+var transitions = map[string][]string{
+	types.EpisodePlanned:   {types.EpisodePacking, types.EpisodeFailed},
+	types.EpisodePacking:   {types.EpisodeDelivered, types.EpisodeFailed},
+	types.EpisodeDelivered: {types.EpisodeVerified, types.EpisodeArchived, types.EpisodePruned, types.EpisodeFailed},
+	types.EpisodeVerified:  {types.EpisodeVerified, types.EpisodeArchived, types.EpisodePruned, types.EpisodeFailed},
+	types.EpisodeArchived:  {types.EpisodeVerified, types.EpisodePruned, types.EpisodeFailed},
+	types.EpisodeFailed:    {types.EpisodePacking, types.EpisodeVerified, types.EpisodePruned},
+}
+
+// Manager 负责系列登记的持久化：记录工作区历次运行产生的分集及其生命周期状态
+type Manager struct {
+	mu sync.Mutex
+}
+
+// NewManager 创建一个新的系列管理器
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// getSeriesPath 返回系列登记文件的绝对路径
+func (m *Manager) getSeriesPath(workspacePath string) string {
+	return filepath.Join(workspacePath, seriesDir, seriesFile)
+}
+
+// NewSeriesID 生成一个新的系列 ID：创建日期加随机后缀
+func NewSeriesID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return "S" + time.Now().Format("20060102") + "-" + hex.EncodeToString(suffix)
+}
+
+// LoadSeries 读取工作区的系列登记
+// 登记不存在时返回一个尚未保存的新系列，seriesID 非空时沿用该 ID（例如清单中已记录的系列）；
+// 登记损坏时返回错误而不是新建，以免分配出重复的分集 ID
+func (m *Manager) LoadSeries(workspacePath, seriesID string) (*types.Series, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := os.ReadFile(m.getSeriesPath(workspacePath))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("读取系列登记失败: %w", err)
+		}
+		if seriesID == "" {
+			seriesID = NewSeriesID()
+		}
+		log.Printf("SeriesManager: No series registry found, starting series %s", seriesID)
+		return &types.Series{
+			ID:        seriesID,
+			Name:      filepath.Base(workspacePath),
+			CreatedAt: time.Now(),
+			Status:    "使用中",
+			Episodes:  []*types.Episode{},
+		}, nil
+	}
+
+	var series types.Series
+	if err := json.Unmarshal(data, &series); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSeriesCorrupted, err)
+	}
+	if series.Episodes == nil {
+		series.Episodes = []*types.Episode{}
+	}
+	clearZeroTimes(&series)
+	return &series, nil
+}
+
+// LoadDeliverySeries 读取随交付包一起保存在交付路径中的系列登记
+func (m *Manager) LoadDeliverySeries(deliveryPath string) (*types.Series, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(deliveryPath, seriesFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrSeriesNotFound, deliveryPath)
+		}
+		return nil, fmt.Errorf("读取系列登记失败: %w", err)
+	}
+	var series types.Series
+	if err := json.Unmarshal(data, &series); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSeriesCorrupted, err)
+	}
+	clearZeroTimes(&series)
+	return &series, nil
+}
+
+// clearZeroTimes 较早的登记为尚未交付或校验的分集写入了零值时间，读取时改为空
+func clearZeroTimes(series *types.Series) {
+	for _, episode := range series.Episodes {
+		if episode.DeliveredAt != nil && episode.DeliveredAt.IsZero() {
+			episode.DeliveredAt = nil
+		}
+		if episode.VerifiedAt != nil && episode.VerifiedAt.IsZero() {
+			episode.VerifiedAt = nil
+		}
+	}
+}
+
+// SaveSeries 将系列登记保存到工作区与交付路径，路径为空时跳过对应的位置
+func (m *Manager) SaveSeries(workspacePath, deliveryPath string, series *types.Series) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := json.MarshalIndent(series, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化系列登记失败: %w", err)
+	}
+
+	if workspacePath != "" {
+		seriesPath := m.getSeriesPath(workspacePath)
+		if err := os.MkdirAll(filepath.Dir(seriesPath), 0755); err != nil {
+			return fmt.Errorf("创建 .beanckup 目录失败: %w", err)
+		}
+		if err := os.WriteFile(seriesPath, data, 0644); err != nil {
+			return fmt.Errorf("写入系列登记失败: %w", err)
+		}
+	}
+	if deliveryPath != "" {
+		if err := os.WriteFile(filepath.Join(deliveryPath, seriesFile), data, 0644); err != nil {
+			return fmt.Errorf("写入交付路径的系列登记失败: %w", err)
+		}
+	}
+
+	log.Printf("SeriesManager: Saved series %s with %d episodes", series.ID, len(series.Episodes))
+	return nil
+}
+
+// FindEpisode 在系列登记中查找分集
+func FindEpisode(series *types.Series, episodeID string) (*types.Episode, error) {
+	for _, episode := range series.Episodes {
+		if episode.ID == episodeID {
+			return episode, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrEpisodeNotFound, episodeID)
+}
+
+// Transition 将分集切换到新的生命周期状态，不允许的状态变化返回错误
+func Transition(episode *types.Episode, status string) error {
+	for _, next := range transitions[episode.Status] {
+		if next == status {
+			episode.Status = status
+			switch status {
+			case types.EpisodeDelivered:
+				now := time.Now()
+				episode.DeliveredAt = &now
+			case types.EpisodeVerified:
+				now := time.Now()
+				episode.VerifiedAt = &now
+				episode.Problems = nil
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: 分集 %s 无法从 %s 变为 %s", ErrInvalidTransition, episode.ID, episode.Status, status)
+}
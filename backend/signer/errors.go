@@ -0,0 +1,20 @@
+package signer
+
+import "errors"
+
+var (
+	// ErrKeyNotFound 工作区没有签名密钥
+	ErrKeyNotFound = errors.New("工作区没有签名密钥")
+
+	// ErrInvalidKey 签名密钥或公钥无效
+	ErrInvalidKey = errors.New("签名密钥无效")
+
+	// ErrUnsigned 清单或清单链的项没有签名
+	ErrUnsigned = errors.New("未签名")
+
+	// ErrBadSignature 签名与内容不符
+	ErrBadSignature = errors.New("签名无效")
+
+	// ErrChainBroken 清单链不完整或与清单不一致
+	ErrChainBroken = errors.New("清单链校验失败")
+)
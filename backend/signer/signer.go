@@ -0,0 +1,388 @@
+package signer
+
+import (
+	"beanckup/backend/types"
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Algorithm 签名算法
+	Algorithm = "ed25519"
+
+	keyDir          = ".beanckup"
+	keyFile         = "signing.key"
+	secretKeyPrefix = "BEANCKUP-SIGNING-KEY-"
+	publicKeyPrefix = "beanckup-sig-"
+
+	// 签名内容的域分隔前缀，防止清单的签名被当作清单链项的签名使用
+	manifestContext = "beanckup manifest v1\n"
+	entryContext    = "beanckup chain entry v1\n"
+)
+
+// Key 工作区的 Ed25519 签名密钥，保存在 .beanckup/signing.key，只由工作区一方持有
+type Key struct {
+	private ed25519.PrivateKey
+}
+
+// keyPath 返回工作区签名密钥的路径
+func keyPath(workspacePath string) string {
+	return filepath.Join(workspacePath, keyDir, keyFile)
+}
+
+// LoadOrCreateKey 读取工作区的签名密钥，不存在时生成新密钥并以 0600 权限保存
+func LoadOrCreateKey(workspacePath string) (*Key, error) {
+	key, err := LoadKey(workspacePath)
+	if err == nil || !os.IsNotExist(err) {
+		return key, err
+	}
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成签名密钥失败: %w", err)
+	}
+	key = &Key{private: private}
+	path := keyPath(workspacePath)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建 .beanckup 目录失败: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("创建签名密钥文件失败: %w", err)
+	}
+	content := fmt.Sprintf("# public key: %s\n%s%s\n", key.PublicKey(), secretKeyPrefix, base64.RawURLEncoding.EncodeToString(private.Seed()))
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("写入签名密钥文件失败: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("写入签名密钥文件失败: %w", err)
+	}
+	return key, nil
+}
+
+// LoadKey 读取工作区的签名密钥，文件不存在时返回的错误满足 os.IsNotExist
+func LoadKey(workspacePath string) (*Key, error) {
+	file, err := os.Open(keyPath(workspacePath))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		seed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(line, secretKeyPrefix))
+		if !strings.HasPrefix(line, secretKeyPrefix) || err != nil || len(seed) != ed25519.SeedSize {
+			break
+		}
+		return &Key{private: ed25519.NewKeyFromSeed(seed)}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrInvalidKey, keyPath(workspacePath))
+}
+
+// WorkspacePublicKey 返回工作区签名密钥的公钥，没有签名密钥时返回 ErrKeyNotFound
+func WorkspacePublicKey(workspacePath string) (string, error) {
+	key, err := LoadKey(workspacePath)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("%w: %s", ErrKeyNotFound, workspacePath)
+	}
+	if err != nil {
+		return "", err
+	}
+	return key.PublicKey(), nil
+}
+
+// PublicKey 返回签名公钥的文本形式 beanckup-sig-<base64url>
+func (k *Key) PublicKey() string {
+	return publicKeyPrefix + base64.RawURLEncoding.EncodeToString(k.private.Public().(ed25519.PublicKey))
+}
+
+// sign 以域分隔前缀签署摘要
+func (k *Key) sign(context, digest string) *types.Signature {
+	return &types.Signature{
+		Algorithm: Algorithm,
+		PublicKey: k.PublicKey(),
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(k.private, []byte(context+digest))),
+	}
+}
+
+// verify 校验签名并返回签名公钥
+func verify(signature *types.Signature, context, digest string) (string, error) {
+	if signature == nil {
+		return "", ErrUnsigned
+	}
+	if signature.Algorithm != Algorithm {
+		return "", fmt.Errorf("%w: 不支持的签名算法 %s", ErrBadSignature, signature.Algorithm)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(signature.PublicKey, publicKeyPrefix))
+	if !strings.HasPrefix(signature.PublicKey, publicKeyPrefix) || err != nil || len(raw) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("%w: 签名公钥无效", ErrBadSignature)
+	}
+	value, err := base64.StdEncoding.DecodeString(signature.Value)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(raw), []byte(context+digest), value) {
+		return "", ErrBadSignature
+	}
+	return signature.PublicKey, nil
+}
+
+// ManifestHash 返回清单（不含签名）的 SHA-256
+// 按结构体字段顺序序列化，映射的键有序，读取时补全的空映射与空值视为相同，保证写入与读回的清单哈希一致
+func ManifestHash(manifest *types.Manifest) (string, error) {
+	unsigned := *manifest
+	unsigned.Signature = nil
+	if unsigned.Files == nil {
+		unsigned.Files = map[string]*types.FileInfo{}
+	}
+	if unsigned.Dirs == nil {
+		unsigned.Dirs = map[string]*types.DirInfo{}
+	}
+	if unsigned.HashToFile == nil {
+		unsigned.HashToFile = map[string]string{}
+	}
+	return ContentHash(&unsigned)
+}
+
+// ContentHash 返回值按 JSON 序列化后的 SHA-256，manifest_manager 用它按较早的结构版本计算迁移前清单的哈希
+func ContentHash(value any) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("序列化清单失败: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SignManifest 签署清单，签名覆盖除签名本身以外的全部字段（包括上一份清单的哈希），返回清单哈希
+func (k *Key) SignManifest(manifest *types.Manifest) (string, error) {
+	hash, err := ManifestHash(manifest)
+	if err != nil {
+		return "", err
+	}
+	manifest.Signature = k.sign(manifestContext, hash)
+	return hash, nil
+}
+
+// VerifyManifest 校验清单的签名，返回签名公钥与清单哈希
+// 清单记录了读取时按保存内容计算的哈希（SourceHash）时按该哈希校验
+func VerifyManifest(manifest *types.Manifest) (string, string, error) {
+	hash := manifest.SourceHash
+	if hash == "" {
+		var err error
+		if hash, err = ManifestHash(manifest); err != nil {
+			return "", "", err
+		}
+	}
+	publicKey, err := verify(manifest.Signature, manifestContext, hash)
+	return publicKey, hash, err
+}
+
+// entryDigest 返回清单链项（不含签名）的 SHA-256
+func entryDigest(entry *types.ChainEntry) (string, error) {
+	unsigned := *entry
+	unsigned.Signature = nil
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return "", fmt.Errorf("序列化清单链失败: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Append 为已签名的清单在清单链末尾追加一项并签名，episodes 为本次运行交付的分集
+func (k *Key) Append(chain *types.ManifestChain, manifest *types.Manifest, episodes []*types.ChainEpisode) error {
+	hash, err := ManifestHash(manifest)
+	if err != nil {
+		return err
+	}
+	entry := &types.ChainEntry{
+		Sequence:     len(chain.Entries) + 1,
+		ManifestHash: hash,
+		PrevHash:     manifest.PrevHash,
+		CreatedAt:    manifest.CreatedAt,
+		Episodes:     episodes,
+	}
+	digest, err := entryDigest(entry)
+	if err != nil {
+		return err
+	}
+	entry.Signature = k.sign(entryContext, digest)
+	chain.Entries = append(chain.Entries, entry)
+	return nil
+}
+
+// AppendRotation 密钥轮换后在清单链末尾追加一项并签名，重新登记轮换后的交付包及其校验和
+// 轮换不产生新的清单，这一项的清单哈希与上一项相同，之后的清单仍链接到同一份清单
+func (k *Key) AppendRotation(chain *types.ManifestChain, episodes []*types.ChainEpisode) error {
+	tip := Tip(chain)
+	if tip == "" {
+		return fmt.Errorf("%w: 清单链为空，无法登记密钥轮换", ErrChainBroken)
+	}
+	entry := &types.ChainEntry{
+		Sequence:     len(chain.Entries) + 1,
+		ManifestHash: tip,
+		PrevHash:     tip,
+		CreatedAt:    time.Now(),
+		Episodes:     episodes,
+		KeyRotation:  true,
+	}
+	digest, err := entryDigest(entry)
+	if err != nil {
+		return err
+	}
+	entry.Signature = k.sign(entryContext, digest)
+	chain.Entries = append(chain.Entries, entry)
+	return nil
+}
+
+// Episodes 返回清单链中登记的每个分集的最新记录，密钥轮换项中的记录覆盖此前登记的记录
+func Episodes(chain *types.ManifestChain) map[string]*types.ChainEpisode {
+	episodes := make(map[string]*types.ChainEpisode)
+	for _, entry := range chainEntries(chain) {
+		for _, episode := range entry.Episodes {
+			episodes[episode.ID] = episode
+		}
+	}
+	return episodes
+}
+
+// Tip 返回清单链最后一项的清单哈希，作为下一份清单的 PrevHash；清单链为空时返回空字符串
+func Tip(chain *types.ManifestChain) string {
+	if chain == nil || len(chain.Entries) == 0 {
+		return ""
+	}
+	return chain.Entries[len(chain.Entries)-1].ManifestHash
+}
+
+// Verify 校验清单与清单链：每一项的签名与序号、相邻项的哈希链接、清单的签名及其与最后一项的对应关系，
+// 以及清单引用的每个交付包都登记在清单链中；全部签名都必须由 trustedKey 签署
+// trustedKey 为空时签名只能证明内容自洽（任何人都能用自己的密钥重新签署整套清单与清单链），
+// 签名者报告为未经确认；返回的报告列出发现的全部问题；清单未签名且清单链为空时视为签名功能启用前的旧交付，只报告未签名
+func Verify(chain *types.ManifestChain, manifest *types.Manifest, trustedKey string) *types.IntegrityReport {
+	report := &types.IntegrityReport{Problems: []string{}}
+	if chain != nil {
+		report.ChainLength = len(chain.Entries)
+	}
+	if manifest.Signature == nil && report.ChainLength == 0 {
+		report.Problems = append(report.Problems, "清单未签名")
+		return report
+	}
+
+	// 未提供受信任的公钥时以第一个签名的公钥为准，只检查全部签名出自同一个公钥
+	signer := trustedKey
+	mismatch := false
+	checkKey := func(label, publicKey string) {
+		if signer == "" {
+			signer = publicKey
+		}
+		if publicKey != signer {
+			mismatch = true
+			report.Problems = append(report.Problems, fmt.Sprintf("%s的签名公钥 %s 与 %s 不一致", label, publicKey, signer))
+		}
+	}
+
+	prevHash := ""
+	var last *types.ChainEntry // 最后一项对应清单的项（不含密钥轮换项）
+	for i, entry := range chainEntries(chain) {
+		label := fmt.Sprintf("清单链第 %d 项", i+1)
+		digest, err := entryDigest(entry)
+		if err == nil {
+			var publicKey string
+			if publicKey, err = verify(entry.Signature, entryContext, digest); err == nil {
+				checkKey(label, publicKey)
+			}
+		}
+		if err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s: %v", label, err))
+		}
+		if entry.Sequence != i+1 {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s的序号为 %d", label, entry.Sequence))
+		}
+		if entry.PrevHash != prevHash {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s与上一项的清单哈希不衔接", label))
+		}
+		if entry.KeyRotation && entry.ManifestHash != entry.PrevHash {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s是密钥轮换项，但清单哈希与上一项不同", label))
+		}
+		prevHash = entry.ManifestHash
+		if !entry.KeyRotation {
+			last = entry
+		}
+	}
+	registered := Episodes(chain)
+
+	publicKey, hash, err := VerifyManifest(manifest)
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("清单: %v", err))
+	} else {
+		report.Signed = true
+		checkKey("清单", publicKey)
+	}
+	switch {
+	case report.ChainLength == 0:
+		report.Problems = append(report.Problems, "清单链缺失")
+	case hash != prevHash:
+		report.Problems = append(report.Problems, "清单与清单链的最后一项不一致")
+	case last == nil || manifest.PrevHash != last.PrevHash:
+		report.Problems = append(report.Problems, "清单记录的上一份清单哈希与清单链不一致")
+	}
+	for id, name := range manifest.Packages {
+		if episode := registered[id]; episode == nil || episode.PackageName != name {
+			report.Problems = append(report.Problems, fmt.Sprintf("交付包 %s（%s）未登记在清单链中", name, id))
+		}
+	}
+	report.PublicKey = signer
+	switch {
+	case trustedKey == "" && signer != "":
+		report.Problems = append(report.Problems, fmt.Sprintf("签名公钥 %s 未经确认：未提供受信任的签名公钥", signer))
+	case trustedKey != "":
+		report.Trusted = report.Signed && !mismatch
+	}
+	return report
+}
+
+// VerifySeries 比对系列登记与清单链：已交付的分集必须登记在清单链中，且交付包名称与校验和一致
+func VerifySeries(chain *types.ManifestChain, series *types.Series) []string {
+	registered := Episodes(chain)
+	problems := []string{}
+	for _, episode := range series.Episodes {
+		if episode.PackagePath == "" {
+			continue
+		}
+		switch episode.Status {
+		case types.EpisodePlanned, types.EpisodePacking, types.EpisodeFailed:
+			continue
+		}
+		signed := registered[episode.ID]
+		switch {
+		case signed == nil:
+			problems = append(problems, fmt.Sprintf("系列登记中的分集 %s 未登记在清单链中", episode.ID))
+		case signed.PackageName != filepath.Base(episode.PackagePath):
+			problems = append(problems, fmt.Sprintf("系列登记中分集 %s 的交付包 %s 与清单链记录的 %s 不一致", episode.ID, filepath.Base(episode.PackagePath), signed.PackageName))
+		case signed.Checksum != "" && episode.Checksum != signed.Checksum:
+			problems = append(problems, fmt.Sprintf("系列登记中分集 %s 的校验和与清单链记录的不一致", episode.ID))
+		}
+	}
+	return problems
+}
+
+// chainEntries 返回清单链的全部项，清单链为空时返回 nil
+func chainEntries(chain *types.ManifestChain) []*types.ChainEntry {
+	if chain == nil {
+		return nil
+	}
+	return chain.Entries
+}
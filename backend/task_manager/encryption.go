@@ -0,0 +1,214 @@
+package task_manager
+
+import (
+	"beanckup/backend/encryptor"
+	"beanckup/backend/types"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// SetEncryptionMode 设置提供密码时交付包的加密方式：native 使用原生加密层（适用于任意归档格式），7z 交给 7zr 加密打包
+// 无论哪种方式，交付路径中的清单副本都由原生加密层加密
+func (m *Manager) SetEncryptionMode(mode string) error {
+	if mode != types.EncryptionNative && mode != types.Encryption7z {
+		return fmt.Errorf("%w: 未知的加密方式 %q", ErrInvalidConfig, mode)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.encryptionMode = mode
+	log.Printf("Task Manager: Encryption mode set to %s.", mode)
+	return nil
+}
+
+// encryptionModeSetting 返回当前的加密方式
+func (m *Manager) encryptionModeSetting() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.encryptionMode
+}
+
+// SetKeySources 设置除密码外的密钥来源：密钥文件（加密与解密都使用）、X25519 接收者公钥（加密）与私钥文件（解密）
+// 之后的每次交付为密码、每个密钥文件与每个公钥分别封装交付包的数据密钥，任何一方都能独立还原
+func (m *Manager) SetKeySources(keyfiles, recipients, identities []string) error {
+	var sources encryptor.KeySources
+	for _, path := range keyfiles {
+		keyfile, err := encryptor.LoadKeyfile(path)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+		sources.Keyfiles = append(sources.Keyfiles, keyfile)
+	}
+	for _, text := range recipients {
+		publicKey, err := encryptor.ParsePublicKey(text)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+		sources.Recipients = append(sources.Recipients, publicKey)
+	}
+	for _, path := range identities {
+		identity, err := encryptor.LoadIdentity(path)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+		sources.Identities = append(sources.Identities, identity)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keySources = sources
+	log.Printf("Task Manager: Key sources set: %d keyfiles, %d recipients, %d identities.", len(sources.Keyfiles), len(sources.Recipients), len(sources.Identities))
+	return nil
+}
+
+// newKeyring 以密码与当前的密钥来源创建本次操作的密钥环
+func (m *Manager) newKeyring(password string) *encryptor.Keyring {
+	m.mu.Lock()
+	sources := m.keySources
+	m.mu.Unlock()
+	return encryptor.NewKeyring(password, sources)
+}
+
+// GenerateKeyfile 在 path 生成新的密钥文件，返回其密钥标识
+func (m *Manager) GenerateKeyfile(path string) (string, error) {
+	keyfile, err := encryptor.GenerateKeyfile(path)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Task Manager: Generated keyfile %s (%s).", path, keyfile.ID())
+	return keyfile.ID(), nil
+}
+
+// GenerateIdentity 在 path 生成新的 X25519 私钥文件，返回对应的公钥（分发给负责交付的一方作为接收者）
+func (m *Manager) GenerateIdentity(path string) (string, error) {
+	identity, err := encryptor.GenerateIdentity(path)
+	if err != nil {
+		return "", err
+	}
+	publicKey := identity.Recipient()
+	log.Printf("Task Manager: Generated identity %s (%s).", path, publicKey.ID())
+	return publicKey.String(), nil
+}
+
+// checkSeriesPassword 打包前确认本次运行的密码与系列之前使用的一致，返回运行成功后保存到系列的校验值
+// 系列还没有校验值时，用最近一个以密码加密的分集记录的 KEK 标识确认；两者都没有时以本次的密码建立校验值
+func checkSeriesPassword(series *types.Series, keys *encryptor.Keyring) (*types.PasswordVerifier, error) {
+	if err := verifySeriesPassword(series, keys); err != nil {
+		return nil, err
+	}
+	if series.PasswordVerifier != nil || !keys.HasPassword() {
+		return series.PasswordVerifier, nil
+	}
+	verifier, err := keys.NewVerifier()
+	if err != nil {
+		return nil, fmt.Errorf("生成密码校验值失败: %w", err)
+	}
+	return verifier, nil
+}
+
+// verifySeriesPassword 按系列的校验值（或较早分集的密码接收者）确认密码
+// 系列设置了密码时必须提供同一个密码；要更换或取消密码需通过 ChangePassword
+func verifySeriesPassword(series *types.Series, keys *encryptor.Keyring) error {
+	if series.PasswordVerifier != nil {
+		err := keys.CheckPassword(series.PasswordVerifier)
+		if errors.Is(err, encryptor.ErrPasswordRequired) {
+			return fmt.Errorf("%w: 系列已设置密码，请提供密码或先修改密码", encryptor.ErrPasswordMismatch)
+		}
+		return err
+	}
+	if !keys.HasPassword() {
+		return nil
+	}
+	for i := len(series.Episodes) - 1; i >= 0; i-- {
+		// 只参考已交付的分集：失败的运行可能用了输错的密码
+		episode := series.Episodes[i]
+		switch episode.Status {
+		case types.EpisodeDelivered, types.EpisodeVerified, types.EpisodeArchived:
+		default:
+			continue
+		}
+		if episode.Encryption == nil {
+			continue
+		}
+		for _, recipient := range episode.Encryption.Recipients {
+			if recipient.Type == encryptor.RecipientPassword && recipient.KDF != nil {
+				return keys.CheckRecipient(recipient)
+			}
+		}
+	}
+	return nil
+}
+
+// newPasswordVerifier 为密码建立校验值，密码为空时返回 nil
+func newPasswordVerifier(password string) (*types.PasswordVerifier, error) {
+	keys := encryptor.NewKeyring(password, encryptor.KeySources{})
+	defer keys.Wipe()
+	verifier, err := keys.NewVerifier()
+	if err != nil {
+		return nil, fmt.Errorf("生成密码校验值失败: %w", err)
+	}
+	return verifier, nil
+}
+
+// archiveEncryption 一次运行中交付包与清单的加密方式
+type archiveEncryption struct {
+	keys       *encryptor.Keyring    // 没有提供任何密钥时为 nil
+	recipients []encryptor.Recipient // 原生加密层的接收者，整次运行共用（密码只派生一次）
+	use7zr     bool                  // 交付包交给 7zr 加密打包
+}
+
+// newArchiveEncryption 按密码、密钥来源与当前设置准备本次运行的加密；有可用的接收者时立即派生密码的 KEK
+func (m *Manager) newArchiveEncryption(password string) (*archiveEncryption, error) {
+	keys := m.newKeyring(password)
+	if !keys.CanSeal() {
+		return &archiveEncryption{keys: keys}, nil
+	}
+	use7zr := m.encryptionModeSetting() == types.Encryption7z
+	if use7zr && password == "" {
+		keys.Wipe()
+		return nil, fmt.Errorf("%w: 7z 加密需要密码，密钥文件与公钥只适用于原生加密", ErrInvalidConfig)
+	}
+	recipients, err := keys.Recipients()
+	if err != nil {
+		keys.Wipe()
+		return nil, fmt.Errorf("派生加密密钥失败: %w", err)
+	}
+	return &archiveEncryption{keys: keys, recipients: recipients, use7zr: use7zr}, nil
+}
+
+// archiveRecipients 返回原生归档写入器的接收者，不加密或交给 7zr 加密时为空
+func (e *archiveEncryption) archiveRecipients() []encryptor.Recipient {
+	if e.use7zr {
+		return nil
+	}
+	return e.recipients
+}
+
+// extension 返回交付包的扩展名
+func (e *archiveEncryption) extension() string {
+	switch {
+	case e.use7zr:
+		return ".7z"
+	case len(e.recipients) > 0:
+		return ".zip" + encryptor.Suffix
+	default:
+		return ".zip"
+	}
+}
+
+// info 返回记录在分集中的加密信息，未加密时为 nil
+func (e *archiveEncryption) info() *types.EncryptionInfo {
+	switch {
+	case e.use7zr:
+		return &types.EncryptionInfo{Mode: types.Encryption7z, Algorithm: "AES-256"}
+	case len(e.recipients) > 0:
+		return encryptor.Info(e.recipients)
+	default:
+		return nil
+	}
+}
+
+// wipe 清零本次运行的密码与密钥
+func (e *archiveEncryption) wipe() {
+	e.keys.Wipe()
+}
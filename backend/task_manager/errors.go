@@ -17,4 +17,19 @@ var (
 
 	// ErrNoFilesToProcess 没有文件需要处理
 	ErrNoFilesToProcess = errors.New("没有文件需要处理")
+
+	// ErrInsufficientSpace 交付路径剩余空间不足
+	ErrInsufficientSpace = errors.New("交付路径剩余空间不足")
+
+	// ErrFileChanged 文件在打包过程中发生变化
+	ErrFileChanged = errors.New("文件在打包过程中发生变化")
+
+	// ErrPlanInvalidated 备份计划已失效
+	ErrPlanInvalidated = errors.New("备份计划已失效")
+
+	// ErrInvalidPlanEdit 无效的计划编辑
+	ErrInvalidPlanEdit = errors.New("无效的计划编辑")
+
+	// ErrVerificationFailed 交付包校验失败
+	ErrVerificationFailed = errors.New("交付包校验失败")
 )
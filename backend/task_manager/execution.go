@@ -0,0 +1,559 @@
+package task_manager
+
+import (
+	"beanckup/backend/indexer"
+	"beanckup/backend/manifest_manager"
+	"beanckup/backend/packager"
+	"beanckup/backend/throttle"
+	"beanckup/backend/types"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// StartBackupExecution 按预处理生成的备份计划启动实际的备份流程
+// 流程：校验计划 -> 按动态阈值分批读入 -> 并发哈希去重 -> 写入交付包 -> 保存新清单
+func (m *Manager) StartBackupExecution(workspacePath, deliveryPath, planID, password string, ctx context.Context) (*types.BackupExecutionResult, error) {
+	if err := m.beginTask(ctx); err != nil {
+		return nil, err
+	}
+	defer m.endTask()
+
+	log.Printf("Task Manager: Starting backup execution of plan %s for %s to %s", planID, workspacePath, deliveryPath)
+
+	result, err := m.executeBackup(workspacePath, deliveryPath, planID, password)
+	if err != nil {
+		log.Printf("Task Manager: Backup execution failed: %v", err)
+		m.emit("task-complete", map[string]interface{}{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, err
+	}
+
+	m.emit("task-complete", map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("交付完成：写入 %d 个文件，去重 %d 个文件", result.PackedCount, result.DedupCount),
+	})
+	log.Println("Task Manager: Backup execution finished successfully.")
+	return result, nil
+}
+
+// executeBackup 是备份执行的主体
+func (m *Manager) executeBackup(workspacePath, deliveryPath, planID, password string) (*types.BackupExecutionResult, error) {
+	if deliveryPath == "" {
+		return nil, fmt.Errorf("%w: 未指定交付路径", ErrInvalidConfig)
+	}
+	if _, err := os.Stat(workspacePath); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrWorkspaceNotFound, workspacePath)
+	}
+	if err := os.MkdirAll(deliveryPath, 0755); err != nil {
+		return nil, fmt.Errorf("创建交付路径失败: %w", err)
+	}
+
+	// 1. 读取备份计划，重新扫描工作区并校验计划仍然有效
+	plan, err := m.planManager.LoadPlan(workspacePath, planID)
+	if err != nil {
+		return nil, err
+	}
+	currentFiles, currentDirs, err := m.indexer.ScanWorkspace(workspacePath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("扫描工作区失败: %w", err)
+	}
+	if plan.PreserveMetadata {
+		m.indexer.CaptureMetadata(currentFiles, currentDirs)
+	}
+	previousManifest, err := m.manifestManager.LoadLatestManifest(workspacePath)
+	if err != nil {
+		return nil, fmt.Errorf("加载旧备份记录失败: %w", err)
+	}
+	// 校验上一份清单的签名与清单链，新清单将链接到它
+	chain, signingKey, err := m.loadWorkspaceChain(workspacePath, previousManifest)
+	if err != nil {
+		return nil, err
+	}
+	workspaceID, err := m.manifestManager.WorkspaceID(workspacePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 按计划中的分集执行
+	// 被推迟的文件不写入新清单，下次运行时会再次作为变更出现
+	plans, err := resolvePlan(plan, previousManifest, currentFiles)
+	if err != nil {
+		return nil, err
+	}
+	changeInfo := plan.ChangeInfo
+	deletions := effectiveDeletions(plan)
+	metadataChanges := effectiveMetadataChanges(plan)
+	// 只有目录或文件元数据变化（例如新建的空目录、chmod）时也保存新清单
+	dirChanges := m.indexer.CompareDirectories(currentDirs, previousManifest)
+	if len(plans) == 0 && len(deletions) == 0 && len(metadataChanges) == 0 && dirChanges == 0 {
+		return nil, ErrNoFilesToProcess
+	}
+	if changeInfo.DeferredCount > 0 {
+		log.Printf("Task Manager: Deferred %d files (%d bytes) to the next run by policy %s.", changeInfo.DeferredCount, changeInfo.DeferredSize, plan.Policy)
+	}
+
+	// 空间预检：在任何打包工作开始之前确认交付路径放得下
+	spaceCheck, err := m.checkDeliverySpace(deliveryPath, plans, len(previousManifest.Files))
+	if err != nil {
+		return nil, err
+	}
+	if spaceCheck.Warning != "" {
+		m.emit("task-warning", map[string]interface{}{
+			"message": spaceCheck.Warning,
+		})
+	}
+
+	// 提供了密码时派生本次运行的 KEK，交付包与交付路径中的清单都由它加密
+	enc, err := m.newArchiveEncryption(password)
+	if err != nil {
+		return nil, err
+	}
+	defer enc.wipe()
+
+	// 确认密码与系列之前使用的一致，登记本次运行的分集，分配全局唯一的分集 ID 与交付包名称
+	run, err := m.startSeriesRun(workspacePath, deliveryPath, previousManifest, plan.ID, plans, enc.keys)
+	if err != nil {
+		return nil, err
+	}
+	defer run.abort()
+
+	// 3. 计算动态阈值：不超过阈值的文件一次性读入内存，哈希与打包共用同一份数据
+	threshold, err := m.resourceManager.CalculateThreshold()
+	if err != nil {
+		log.Printf("Task Manager: Failed to calculate threshold, using default %d bytes: %v", threshold, err)
+	}
+	log.Printf("Task Manager: In-memory processing threshold: %d bytes.", threshold)
+	m.emit("resource-info", m.resourceManager.GetResourceInfo())
+
+	// 4. 启动工作池，运行期间由资源管理器按 CPU、内存压力与磁盘吞吐动态调整规模
+	pool := m.worker.Pool()
+	if err := pool.Start(m.resourceManager.InitialWorkerCount()); err != nil {
+		return nil, fmt.Errorf("启动工作池失败: %w", err)
+	}
+	defer pool.Stop()
+	autoscaler := m.resourceManager.StartAutoscaler(pool)
+	defer autoscaler.Stop()
+
+	// 5. 逐个分集执行
+	nextManifest := newNextManifest(previousManifest)
+	nextManifest.WorkspacePath = workspacePath
+	nextManifest.WorkspaceID = workspaceID
+	nextManifest.SeriesID = run.series.ID
+	index := buildContentIndex(previousManifest)
+	progress := newProgressTracker(m, plannedSize(plans))
+	result := &types.BackupExecutionResult{
+		Episodes:      episodesOf(plans),
+		Threshold:     threshold,
+		DeferredCount: changeInfo.DeferredCount,
+		DeferredSize:  changeInfo.DeferredSize,
+		SpaceCheck:    spaceCheck,
+	}
+
+	splits := make(map[string]*splitState)
+	for _, plan := range plans {
+		var outcome *episodeOutcome
+		var err error
+		run.begin(plan.episode)
+		// 每个分集在新的工作线程上执行，后台模式的切换从下一个分集起作用于读取、打包与校验
+		throttle.Run(func() {
+			if plan.part != nil {
+				outcome, err = m.executePart(plan, workspacePath, deliveryPath, enc, index, splits, progress)
+			} else {
+				outcome, err = m.executeEpisode(plan, workspacePath, deliveryPath, enc, threshold, index, progress)
+			}
+			if err == nil && plan.episode.PackagePath != "" {
+				plan.episode.Encryption = enc.info()
+				err = m.verifyEpisode(plan, outcome, workspacePath, enc, progress)
+			}
+			if err == nil && plan.episode.PackagePath != "" {
+				plan.episode.Checksum, err = m.verifier.Checksum(plan.episode.PackagePath)
+			}
+			if redundancy := m.parityRedundancySetting(); err == nil && plan.episode.PackagePath != "" && redundancy > 0 {
+				err = m.createParity(plan.episode, redundancy)
+			}
+		})
+		run.record(plan.episode)
+		if err != nil {
+			plan.episode.Status = types.EpisodeFailed
+			m.emitEpisodeStatus(plan.episode)
+			return nil, fmt.Errorf("分集 %s 执行失败: %w", plan.episode.Name, err)
+		}
+
+		for _, file := range outcome.packed {
+			nextManifest.Files[file.Path] = file
+		}
+		for _, file := range outcome.duplicates {
+			nextManifest.Files[file.Path] = file
+		}
+		result.PackedCount += len(outcome.packed)
+		result.DedupCount += len(outcome.duplicates)
+		result.TotalSize += outcome.written
+		nextManifest.EpisodeID = plan.episode.ID
+		if plan.episode.PackagePath != "" {
+			nextManifest.Packages[plan.episode.ID] = filepath.Base(plan.episode.PackagePath)
+		}
+	}
+
+	// 6. 从清单中移除已删除的文件，更新只有元数据变化的文件记录
+	for _, path := range deletions {
+		delete(nextManifest.Files, path)
+		result.DeletedCount++
+	}
+	result.MetadataCount = applyMetadataChanges(nextManifest, metadataChanges, currentFiles)
+
+	// 7. 记录当前的目录（含空目录）并汇总其中的文件，重建哈希索引，签署并保存新清单与清单链
+	indexer.AggregateDirectories(currentDirs, nextManifest.Files)
+	nextManifest.Dirs = currentDirs
+	manifest_manager.RebuildHashIndex(nextManifest)
+	progress.report("保存清单")
+	if err := signManifest(signingKey, chain, nextManifest, run.series); err != nil {
+		return nil, fmt.Errorf("签署清单失败: %w", err)
+	}
+	// 清单与清单链一同保存，任何一方写入失败时两者都保持原样
+	if err := m.manifestManager.SaveManifest(workspacePath, deliveryPath, nextManifest, chain, enc.recipients); err != nil {
+		return nil, fmt.Errorf("保存清单失败: %w", err)
+	}
+	run.manifestSaved()
+	// 清单已保存，备份本身有效；系列登记更新失败时记录在结果中提示用户，不作为运行失败
+	if err := run.commit(deliveryPath, nextManifest, result.Episodes); err != nil {
+		log.Printf("Task Manager: Failed to save series registry: %v", err)
+		result.RegistryError = fmt.Sprintf("更新系列登记失败: %v", err)
+	}
+
+	// 清单已更新，之前生成的计划全部失效
+	if err := m.planManager.ClearPlans(workspacePath); err != nil {
+		log.Printf("Task Manager: Failed to clear backup plans: %v", err)
+	}
+
+	return result, nil
+}
+
+// episodeOutcome 单个分集的执行结果
+type episodeOutcome struct {
+	packed     []*types.FileInfo // 写入交付包的文件
+	duplicates []*types.FileInfo // 内容已存在，仅更新元数据的文件
+	written    int64             // 写入的原始数据量
+}
+
+// executeEpisode 执行单个分集：分批读入、哈希去重并写入交付包
+func (m *Manager) executeEpisode(plan *episodePlan, workspacePath, deliveryPath string, enc *archiveEncryption, threshold int64, index *contentIndex, progress *progressTracker) (*episodeOutcome, error) {
+	episode := plan.episode
+	episode.Status = types.EpisodePacking
+	episode.CreatedAt = time.Now()
+	m.emitEpisodeStatus(episode)
+	log.Printf("Task Manager: Packing episode %s with %d files.", episode.Name, len(plan.files))
+
+	// 选择 7zr 加密时交给 7zr 打包，否则使用原生归档写入器直接消费内存中的数据（提供了密码时经原生加密层写入）
+	use7zr := enc.use7zr
+	var writer packager.ArchiveWriter
+	targetPath := filepath.Join(deliveryPath, episode.Name+enc.extension())
+	if !use7zr {
+		w, err := packager.NewZipArchiveWriter(targetPath, m.packager.WriteLimiter(), enc.archiveRecipients())
+		if err != nil {
+			return nil, err
+		}
+		writer = w
+	}
+
+	outcome := &episodeOutcome{}
+	var pending []*types.FileInfo // 等待解析内容位置的重复文件
+
+	for _, batch := range splitBatches(plan.files, threshold) {
+		batchFiles := make(map[string]*types.FileInfo, len(batch))
+		var batchSize int64
+		for _, file := range batch {
+			batchFiles[file.Path] = file
+			batchSize += file.Size
+		}
+
+		processed, err := m.fileProcessor.ProcessFiles(batchFiles, threshold)
+		if err != nil {
+			closeQuietly(writer)
+			return nil, fmt.Errorf("读取文件失败: %w", err)
+		}
+		tasks := append(processed.SmallFileTasks, processed.LargeFileTasks...)
+
+		var results []*types.WorkerResult
+		if writer == nil {
+			// 7zr 自行读取文件，无法在打包时计算哈希，所有文件都需预先计算
+			progress.report("计算哈希")
+			results = m.worker.HashTasks(tasks, index.has)
+		} else {
+			// 只有大小与已知内容相同的文件才可能重复，需先计算哈希；其余文件在写入时边读边算
+			toHash, toStream := m.worker.PartitionBySize(tasks, index.sizes)
+			progress.report("计算哈希")
+			results = m.worker.HashTasks(toHash, index.has)
+			for _, task := range toStream {
+				results = append(results, &types.WorkerResult{Task: task})
+			}
+			sort.Slice(results, func(i, j int) bool {
+				return results[i].Task.FileInfo.Path < results[j].Task.FileInfo.Path
+			})
+
+			progress.report("压缩中")
+			written, err := m.packager.WriteTasks(writer, results, workspacePath)
+			if err != nil {
+				closeQuietly(writer)
+				return nil, err
+			}
+			outcome.written += written
+		}
+
+		for _, r := range results {
+			if r.Error != nil {
+				// 读取失败的文件不写入清单，下次运行时会被重新识别为变更
+				log.Printf("Task Manager: Skipping file: %v", r.Error)
+				continue
+			}
+			file := r.Task.FileInfo
+			if r.IsDuplicate {
+				pending = append(pending, file)
+				continue
+			}
+			file.EpisodeID = episode.ID
+			if use7zr {
+				file.EntryName = packager.EntryName(file.Path, workspacePath)
+				outcome.written += file.Size
+			}
+			index.add(file)
+			outcome.packed = append(outcome.packed, file)
+		}
+
+		// 释放本批次读入内存的数据
+		for _, task := range tasks {
+			task.Data = nil
+		}
+		progress.advance(batchSize)
+	}
+
+	for _, file := range pending {
+		copyLocation(file, index.byHash[file.ContentHash])
+		outcome.duplicates = append(outcome.duplicates, file)
+	}
+
+	if writer != nil {
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		if len(outcome.packed) == 0 {
+			os.Remove(targetPath)
+			targetPath = ""
+		}
+	} else if len(outcome.packed) > 0 {
+		progress.report("压缩中")
+		password := enc.keys.Password()
+		err := m.packager.CreateArchiveWith7zr(outcome.packed, targetPath, workspacePath, password)
+		clear(password)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		targetPath = ""
+	}
+
+	m.finishEpisode(episode, targetPath, outcome)
+	return outcome, nil
+}
+
+// finishEpisode 记录分集的执行结果并推送状态
+func (m *Manager) finishEpisode(episode *types.Episode, targetPath string, outcome *episodeOutcome) {
+	episode.PackagePath = targetPath
+	episode.FileCount = len(outcome.packed)
+	if episode.PartCount > 0 && targetPath != "" {
+		episode.FileCount = 1 // 分卷分集只包含一个分卷条目
+	}
+	episode.TotalSize = outcome.written
+	episode.Status = types.EpisodeDelivered
+	m.emitEpisodeStatus(episode)
+	log.Printf("Task Manager: Episode %s finished: %d packed, %d deduplicated.", episode.Name, len(outcome.packed), len(outcome.duplicates))
+}
+
+// splitBatches 按内存阈值将文件切分为批次，使每批读入内存的小文件总量不超过阈值
+// 超过阈值的大文件不占用内存预算，随所在批次流式处理
+func splitBatches(files []*types.FileInfo, threshold int64) [][]*types.FileInfo {
+	var batches [][]*types.FileInfo
+	var current []*types.FileInfo
+	var inMemory int64
+
+	for _, file := range files {
+		if file.Size <= threshold {
+			if inMemory+file.Size > threshold && len(current) > 0 {
+				batches = append(batches, current)
+				current = nil
+				inMemory = 0
+			}
+			inMemory += file.Size
+		}
+		current = append(current, file)
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// newNextManifest 以上一次清单为基础创建本次运行的新清单
+func newNextManifest(previous *types.Manifest) *types.Manifest {
+	next := &types.Manifest{
+		Version:    types.ManifestVersion,
+		CreatedAt:  time.Now(),
+		SeriesID:   previous.SeriesID,
+		Files:      make(map[string]*types.FileInfo, len(previous.Files)),
+		Dirs:       previous.Dirs,
+		HashToFile: make(map[string]string),
+		Packages:   make(map[string]string, len(previous.Packages)),
+	}
+	for path, file := range previous.Files {
+		next.Files[path] = file
+	}
+	for id, name := range previous.Packages {
+		next.Packages[id] = name
+	}
+	return next
+}
+
+// contentIndex 内容索引：记录已备份内容所在的文件记录，以及这些内容的大小集合（用于去重预筛选）
+type contentIndex struct {
+	byHash map[string]*types.FileInfo
+	sizes  map[int64]bool
+}
+
+// buildContentIndex 从清单构建内容索引，缺少交付包信息的旧记录无法作为去重来源
+func buildContentIndex(manifest *types.Manifest) *contentIndex {
+	index := &contentIndex{
+		byHash: make(map[string]*types.FileInfo),
+		sizes:  make(map[int64]bool),
+	}
+	for _, file := range manifest.Files {
+		if file.ContentHash == "" || file.EpisodeID == "" {
+			continue
+		}
+		index.add(file)
+	}
+	return index
+}
+
+// add 登记一个已写入交付包的文件
+func (c *contentIndex) add(file *types.FileInfo) {
+	if _, exists := c.byHash[file.ContentHash]; !exists {
+		c.byHash[file.ContentHash] = file
+	}
+	c.sizes[file.Size] = true
+}
+
+// has 判断某个哈希的内容是否已经备份过
+func (c *contentIndex) has(hash string) bool {
+	_, exists := c.byHash[hash]
+	return exists
+}
+
+// copyLocation 让重复文件指向已备份内容所在的位置
+func copyLocation(file, source *types.FileInfo) {
+	file.EpisodeID = source.EpisodeID
+	file.EntryName = source.EntryName
+	file.Parts = source.Parts
+}
+
+// closeQuietly 在出错路径上关闭归档写入器
+func closeQuietly(writer packager.ArchiveWriter) {
+	if writer != nil {
+		writer.Close()
+	}
+}
+
+// beginTask 标记任务开始，同一时间只允许一个任务运行
+func (m *Manager) beginTask(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isRunning {
+		return ErrTaskAlreadyRunning
+	}
+	m.isRunning = true
+	m.ctx = ctx
+	return nil
+}
+
+// endTask 标记任务结束
+func (m *Manager) endTask() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.isRunning = false
+}
+
+// emit 向前端推送事件
+func (m *Manager) emit(event string, data interface{}) {
+	if m.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(m.ctx, event, data)
+}
+
+// emitEpisodeStatus 推送分集状态变化
+func (m *Manager) emitEpisodeStatus(episode *types.Episode) {
+	m.emit("episode-status-update", map[string]interface{}{
+		"episodeName": episode.Name,
+		"status":      episode.Status,
+	})
+}
+
+// progressTracker 按处理的数据量统计整体进度
+type progressTracker struct {
+	manager    *Manager
+	startTime  time.Time
+	totalBytes int64
+	doneBytes  int64
+	phase      string
+}
+
+// newProgressTracker 创建进度统计器
+func newProgressTracker(manager *Manager, totalBytes int64) *progressTracker {
+	return &progressTracker{
+		manager:    manager,
+		startTime:  time.Now(),
+		totalBytes: totalBytes,
+	}
+}
+
+// advance 记录已处理的数据量并推送进度
+func (p *progressTracker) advance(n int64) {
+	p.doneBytes += n
+	p.report(p.phase)
+}
+
+// report 推送当前进度
+func (p *progressTracker) report(phase string) {
+	p.phase = phase
+	elapsed := time.Since(p.startTime).Seconds()
+
+	progress := 1.0
+	if p.totalBytes > 0 {
+		progress = float64(p.doneBytes) / float64(p.totalBytes)
+	}
+
+	speed := 0.0
+	estimated := 0.0
+	if elapsed > 0 {
+		speed = float64(p.doneBytes) / 1024 / 1024 / elapsed // MB/s
+		if progress > 0 {
+			estimated = elapsed / progress * (1 - progress)
+		}
+	}
+
+	p.manager.emit("task-progress", map[string]interface{}{
+		"totalProgress": progress,
+		"currentSpeed":  speed,
+		"elapsedTime":   int64(elapsed),
+		"estimatedTime": int64(estimated),
+		"currentPhase":  phase,
+		"workerCount":   p.manager.worker.Pool().WorkerCount(),
+	})
+}
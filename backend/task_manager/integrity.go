@@ -0,0 +1,106 @@
+package task_manager
+
+import (
+	"beanckup/backend/manifest_manager"
+	"beanckup/backend/signer"
+	"beanckup/backend/types"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// loadWorkspaceChain 执行前读取工作区的签名密钥与清单链，并校验上一份清单
+// 发现问题时拒绝执行，避免为被篡改的清单续签；清单未签名且没有清单链时视为签名功能启用前的工作区，从本次运行开始签名，
+// 只有这时才生成签名密钥，之后签名密钥丢失时返回 signer.ErrKeyNotFound
+func (m *Manager) loadWorkspaceChain(workspacePath string, previous *types.Manifest) (*types.ManifestChain, *signer.Key, error) {
+	chain, err := m.manifestManager.LoadChain(workspacePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 已经签名过的工作区不再生成新密钥：新密钥无法延续原有的清单链，丢失的密钥需要从备份中找回
+	var key *signer.Key
+	if len(chain.Entries) > 0 || previous.Signature != nil {
+		key, err = signer.LoadKey(workspacePath)
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("%w: 工作区已有签名的清单，需要找回原有的签名密钥 .beanckup/signing.key", signer.ErrKeyNotFound)
+		}
+	} else {
+		key, err = signer.LoadOrCreateKey(workspacePath)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if previous.Signature == nil && len(chain.Entries) == 0 {
+		return chain, key, nil
+	}
+	report := signer.Verify(chain, previous, key.PublicKey())
+	if len(report.Problems) > 0 {
+		return nil, nil, fmt.Errorf("%w: %s", signer.ErrChainBroken, strings.Join(report.Problems, "; "))
+	}
+	return chain, key, nil
+}
+
+// signManifest 将新清单链接到清单链的最后一项并签名，在清单链末尾登记本次运行
+// 签名针对清单保存时的形式（相对路径），工作区移动后签名仍然有效；
+// 清单引用但尚未登记的交付包（本次交付的，以及签名功能启用前交付的）连同系列登记中的校验和都登记在这一项中
+func signManifest(key *signer.Key, chain *types.ManifestChain, manifest *types.Manifest, series *types.Series) error {
+	manifest.PrevHash = signer.Tip(chain)
+	stored, err := manifest_manager.StoredForm(manifest)
+	if err != nil {
+		return err
+	}
+	hash, err := key.SignManifest(stored)
+	if err != nil {
+		return err
+	}
+	manifest.Signature = stored.Signature
+	manifest.SourceHash = hash
+
+	registered := signer.Episodes(chain)
+	records := make(map[string]*types.Episode, len(series.Episodes))
+	for _, episode := range series.Episodes {
+		records[episode.ID] = episode
+	}
+	ids := make([]string, 0, len(manifest.Packages))
+	for id := range manifest.Packages {
+		if registered[id] == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	episodes := make([]*types.ChainEpisode, 0, len(ids))
+	for _, id := range ids {
+		episode := &types.ChainEpisode{ID: id, PackageName: manifest.Packages[id]}
+		if record := records[id]; record != nil {
+			episode.FileCount = record.FileCount
+			episode.TotalSize = record.TotalSize
+			episode.Checksum = record.Checksum
+		}
+		episodes = append(episodes, episode)
+	}
+	return key.Append(chain, stored, episodes)
+}
+
+// SigningPublicKey 返回工作区的签名公钥，供还原与校验交付路径时作为受信任的公钥固定下来
+func (m *Manager) SigningPublicKey(workspacePath string) (string, error) {
+	return signer.WorkspacePublicKey(workspacePath)
+}
+
+// verifyDeliveryIntegrity 校验交付路径中清单的签名、清单链以及系列登记，返回发现的全部问题
+// 要求全部签名都由调用方固定的 trustedKey 签署；清单中记录的工作区路径同样来自交付路径，不据此查找受信任的公钥
+func (m *Manager) verifyDeliveryIntegrity(deliveryPath string, manifest *types.Manifest, trustedKey string) *types.IntegrityReport {
+	chain, chainErr := m.manifestManager.LoadDeliveryChain(deliveryPath)
+	report := signer.Verify(chain, manifest, trustedKey)
+	if chainErr != nil {
+		report.Problems = append(report.Problems, chainErr.Error())
+	}
+	if series, err := m.seriesManager.LoadDeliverySeries(deliveryPath); err == nil {
+		report.Problems = append(report.Problems, signer.VerifySeries(chain, series)...)
+	}
+	if len(report.Problems) > 0 {
+		log.Printf("Task Manager: Integrity check of %s found %d problems: %s", deliveryPath, len(report.Problems), strings.Join(report.Problems, "; "))
+	}
+	return report
+}
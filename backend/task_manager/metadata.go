@@ -0,0 +1,40 @@
+package task_manager
+
+import (
+	"beanckup/backend/types"
+	"log"
+)
+
+// SetMetadataPreservation 设置是否记录文件与目录的权限、属主与扩展属性（包括 ACL），还原时据此恢复
+// 目前只支持 Linux；设置在预处理时写入备份计划，开始交付时按计划重新读取
+func (m *Manager) SetMetadataPreservation(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.preserveMetadata = enabled
+	log.Printf("Task Manager: Metadata preservation set to %v.", enabled)
+}
+
+// metadataPreservationSetting 返回当前是否保留元数据
+func (m *Manager) metadataPreservationSetting() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.preserveMetadata
+}
+
+// applyMetadataChanges 为只有元数据变化的文件更新清单记录：内容所在的分集与条目不变，只替换权限、属主与扩展属性
+func applyMetadataChanges(manifest *types.Manifest, changes []*types.FileInfo, currentFiles map[string]*types.FileInfo) int {
+	updated := 0
+	for _, change := range changes {
+		previous, exists := manifest.Files[change.Path]
+		current := currentFiles[change.Path]
+		if !exists || current == nil {
+			continue
+		}
+		record := *previous
+		record.Posix = current.Posix
+		record.Status = types.StatusMetadata
+		manifest.Files[change.Path] = &record
+		updated++
+	}
+	return updated
+}
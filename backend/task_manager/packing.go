@@ -0,0 +1,134 @@
+package task_manager
+
+import (
+	"beanckup/backend/types"
+	"log"
+	"path/filepath"
+	"sort"
+)
+
+// packItem 装箱的最小单位：同一目录下需要放在一起的一组文件
+type packItem struct {
+	key   string // 用于排序的稳定键（组内第一个文件的路径）
+	files []*types.FileInfo
+	size  int64
+}
+
+// packBin 装箱过程中的一个分集
+type packBin struct {
+	files     []*types.FileInfo
+	size      int64
+	part      *types.FilePart // 非 nil 表示该分集只承载某个超大文件的一个分卷
+	partCount int
+}
+
+// packEpisodes 将文件确定性地分配到分集中
+// 1. 按所在目录分组，整组放得进一个包时作为一个整体装箱，尽量让同一目录落在同一个包里；
+// 2. 目录总量超过包大小上限时，按路径顺序切成若干连续的段，每段各自作为一个整体；
+// 3. 单个文件超过包大小上限时按包大小上限切分为若干分卷，每个分卷独占一个分集，且各分卷的分集编号连续；
+// 4. 其余按首次适应递减（FFD）装箱，以减少分集数量。
+// 结果只取决于文件集合本身，与 map 遍历顺序无关
+func packEpisodes(files []*types.FileInfo, maxPackageSize int64) []*packBin {
+	var bins []*packBin
+	var items []*packItem
+
+	for _, group := range groupByDir(files) {
+		var current *packItem
+		for _, file := range group {
+			if file.Size > maxPackageSize {
+				parts := splitParts(file, maxPackageSize)
+				log.Printf("Task Manager: File %s (%d bytes) exceeds the package size limit, splitting it into %d parts.", file.Path, file.Size, len(parts))
+				bins = append(bins, parts...)
+				continue
+			}
+			if current == nil || current.size+file.Size > maxPackageSize {
+				current = &packItem{key: file.Path}
+				items = append(items, current)
+			}
+			current.files = append(current.files, file)
+			current.size += file.Size
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].size != items[j].size {
+			return items[i].size > items[j].size
+		}
+		return items[i].key < items[j].key
+	})
+
+	var open []*packBin
+	for _, item := range items {
+		var target *packBin
+		for _, bin := range open {
+			if bin.size+item.size <= maxPackageSize {
+				target = bin
+				break
+			}
+		}
+		if target == nil {
+			target = &packBin{}
+			open = append(open, target)
+		}
+		target.files = append(target.files, item.files...)
+		target.size += item.size
+	}
+	bins = append(bins, open...)
+
+	// 分集内按路径排序，分集之间按第一个文件的路径排序，使编号稳定且便于查找；
+	// 同一文件的各分卷按追加顺序保持相邻
+	for _, bin := range bins {
+		sort.Slice(bin.files, func(i, j int) bool {
+			return bin.files[i].Path < bin.files[j].Path
+		})
+	}
+	sort.SliceStable(bins, func(i, j int) bool {
+		return bins[i].files[0].Path < bins[j].files[0].Path
+	})
+	return bins
+}
+
+// groupByDir 按所在目录对文件分组，目录与组内文件均按路径排序
+func groupByDir(files []*types.FileInfo) [][]*types.FileInfo {
+	groups := make(map[string][]*types.FileInfo)
+	for _, file := range files {
+		dir := filepath.Dir(file.Path)
+		groups[dir] = append(groups[dir], file)
+	}
+
+	dirs := make([]string, 0, len(groups))
+	for dir := range groups {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	result := make([][]*types.FileInfo, 0, len(dirs))
+	for _, dir := range dirs {
+		group := groups[dir]
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].Path < group[j].Path
+		})
+		result = append(result, group)
+	}
+	return result
+}
+
+// splitParts 将超过包大小上限的文件按上限切分为连续的分卷，每个分卷对应一个分集
+func splitParts(file *types.FileInfo, maxPackageSize int64) []*packBin {
+	count := int((file.Size + maxPackageSize - 1) / maxPackageSize)
+	bins := make([]*packBin, 0, count)
+	for i := 0; i < count; i++ {
+		offset := int64(i) * maxPackageSize
+		size := maxPackageSize
+		if offset+size > file.Size {
+			size = file.Size - offset
+		}
+		bins = append(bins, &packBin{
+			files:     []*types.FileInfo{file},
+			size:      size,
+			part:      &types.FilePart{Index: i + 1, Offset: offset, Size: size},
+			partCount: count,
+		})
+	}
+	return bins
+}
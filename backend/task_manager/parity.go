@@ -0,0 +1,109 @@
+package task_manager
+
+import (
+	"beanckup/backend/parity"
+	"beanckup/backend/types"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// SetParityRedundancy 设置为每个交付包生成的恢复数据冗余比例（百分比，0 表示不生成）
+func (m *Manager) SetParityRedundancy(percent int) error {
+	if percent < 0 || percent > 100 {
+		return parity.ErrInvalidRedundancy
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.parityRedundancy = percent
+	log.Printf("Task Manager: Parity redundancy set to %d%%.", percent)
+	return nil
+}
+
+// parityRedundancySetting 返回当前的恢复数据冗余比例
+func (m *Manager) parityRedundancySetting() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.parityRedundancy
+}
+
+// createParity 为分集的交付包生成恢复数据文件
+func (m *Manager) createParity(episode *types.Episode, redundancy int) error {
+	parityPath, err := m.parity.Create(episode.PackagePath, episode.Checksum, redundancy)
+	if err != nil {
+		return fmt.Errorf("生成恢复数据失败: %w", err)
+	}
+	episode.ParityFile = filepath.Base(parityPath)
+	episode.Redundancy = redundancy
+	return nil
+}
+
+// VerifyParity 按恢复数据校验交付路径中清单引用的交付包，返回每个带恢复数据的交付包的校验结果
+func (m *Manager) VerifyParity(deliveryPath string, ctx context.Context) ([]*types.ParityReport, error) {
+	return m.checkParity(deliveryPath, false, ctx)
+}
+
+// RepairDelivery 按恢复数据修复交付路径中损坏的交付包，修复结果记录到系列登记
+func (m *Manager) RepairDelivery(deliveryPath string, ctx context.Context) ([]*types.ParityReport, error) {
+	return m.checkParity(deliveryPath, true, ctx)
+}
+
+// checkParity 遍历系列登记中带有恢复数据文件的交付包，逐个校验，repair 为 true 时修复损坏的交付包
+// 系列登记不含文件内容信息，交付路径中的清单加密时也无需密码即可校验与修复
+func (m *Manager) checkParity(deliveryPath string, repair bool, ctx context.Context) ([]*types.ParityReport, error) {
+	if err := m.beginTask(ctx); err != nil {
+		return nil, err
+	}
+	defer m.endTask()
+
+	series, err := m.seriesManager.LoadDeliverySeries(deliveryPath)
+	if err != nil {
+		return nil, fmt.Errorf("加载系列登记失败: %w", err)
+	}
+	packages := make(map[string]string)
+	ids := make([]string, 0, len(series.Episodes))
+	for _, episode := range series.Episodes {
+		if episode.ParityFile == "" || episode.PackagePath == "" || episode.Status == types.EpisodePruned {
+			continue
+		}
+		packages[episode.ID] = filepath.Base(episode.PackagePath)
+		ids = append(ids, episode.ID)
+	}
+	sort.Strings(ids)
+
+	reports := []*types.ParityReport{}
+	results := make(map[string][]string) // 修复成功或无法修复的分集，用于更新系列登记
+	for _, id := range ids {
+		packagePath := filepath.Join(deliveryPath, packages[id])
+		if _, err := os.Stat(packagePath + parity.Suffix); err != nil {
+			continue
+		}
+		if !repair {
+			reports = append(reports, m.parity.Verify(packagePath))
+			continue
+		}
+		report, err := m.parity.Repair(packagePath)
+		reports = append(reports, report)
+		switch {
+		case err != nil:
+			log.Printf("Task Manager: Failed to repair %s: %v", packagePath, err)
+			results[id] = report.Problems
+		case report.Repaired:
+			results[id] = nil
+		}
+	}
+
+	if repair && len(results) > 0 {
+		// 工作区路径记录在清单中；清单已加密时只更新交付路径中的系列登记
+		workspacePath := ""
+		if manifest, err := m.manifestManager.LoadDeliveryManifest(deliveryPath, nil); err == nil {
+			workspacePath = manifest.WorkspacePath
+		}
+		m.recordChecks(series, workspacePath, deliveryPath, results)
+	}
+	log.Printf("Task Manager: Checked parity of %d archives in %s (repair: %v).", len(reports), deliveryPath, repair)
+	return reports, nil
+}
@@ -0,0 +1,267 @@
+package task_manager
+
+import (
+	"beanckup/backend/indexer"
+	"beanckup/backend/plan_manager"
+	"beanckup/backend/types"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxReportedPaths 计划失效时错误信息中最多列出的文件数
+const maxReportedPaths = 5
+
+// newBackupPlan 根据预处理发现的变更创建备份计划，分集由 replan 计算
+func newBackupPlan(options *planOptions, previous *types.Manifest, changedFiles map[string]*types.FileInfo) *types.BackupPlan {
+	plan := &types.BackupPlan{
+		ID:              plan_manager.NewPlanID(),
+		CreatedAt:       time.Now(),
+		WorkspacePath:   options.workspacePath,
+		BaseManifest:    manifestFingerprint(previous),
+		MaxPackageSize:  options.maxPackageSize,
+		MaxTotalSize:    options.maxTotalSize,
+		Policy:          options.policy,
+		PriorityFolders: options.priorityFolders,
+		Candidates:      []*types.FileInfo{},
+		DeletedFiles:    []string{},
+	}
+	for path, file := range changedFiles {
+		switch file.Status {
+		case types.StatusNew, types.StatusModified:
+			plan.Candidates = append(plan.Candidates, file)
+		case types.StatusDeleted:
+			plan.DeletedFiles = append(plan.DeletedFiles, path)
+		case types.StatusMetadata:
+			plan.MetadataFiles = append(plan.MetadataFiles, file)
+		}
+	}
+	sort.Slice(plan.Candidates, func(i, j int) bool {
+		return plan.Candidates[i].Path < plan.Candidates[j].Path
+	})
+	sort.Slice(plan.MetadataFiles, func(i, j int) bool {
+		return plan.MetadataFiles[i].Path < plan.MetadataFiles[j].Path
+	})
+	sort.Strings(plan.DeletedFiles)
+	return plan
+}
+
+// replan 根据计划中的候选文件、用户的排除规则与固定分配重新计算分集、变更统计与推迟文件
+func replan(plan *types.BackupPlan) ([]*episodePlan, error) {
+	options := optionsOf(plan)
+	changeInfo := types.ChangeInfo{DeletedCount: len(effectiveDeletions(plan)), DirChangeCount: plan.ChangeInfo.DirChangeCount}
+	changeInfo.MetadataCount = len(effectiveMetadataChanges(plan))
+
+	var included []*types.FileInfo
+	for _, file := range plan.Candidates {
+		if file.Status == types.StatusNew {
+			changeInfo.NewCount++
+		} else {
+			changeInfo.ModifiedCount++
+		}
+		changeInfo.TotalSize += file.Size
+		if options.isExcluded(file.Path) {
+			changeInfo.ExcludedCount++
+			changeInfo.ExcludedSize += file.Size
+			continue
+		}
+		included = append(included, file)
+	}
+
+	selected, deferred := selectForBudget(included, options)
+	deferredFiles := make([]string, 0, len(deferred))
+	for _, file := range deferred {
+		changeInfo.DeferredCount++
+		changeInfo.DeferredSize += file.Size
+		deferredFiles = append(deferredFiles, file.Path)
+	}
+
+	plans, err := assignEpisodes(selected, options)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.ChangeInfo = changeInfo
+	plan.DeferredFiles = deferredFiles
+	plan.Episodes = make([]*types.PlannedEpisode, 0, len(plans))
+	for _, p := range plans {
+		plan.Episodes = append(plan.Episodes, &types.PlannedEpisode{
+			Episode: p.episode,
+			Files:   p.files,
+			Part:    p.part,
+		})
+	}
+	return plans, nil
+}
+
+// assignEpisodes 将选中的文件分配到分集：固定到某个分集的文件使用指定的分集编号，
+// 其余文件按确定性装箱（同目录尽量同包，首次适应递减，超大文件拆分为连续的分卷）依次占用最小的空闲编号；
+// 超大文件的全部分卷占用一段连续的空闲编号，不会被固定的分集隔开
+func assignEpisodes(files []*types.FileInfo, options *planOptions) ([]*episodePlan, error) {
+	pinned := make(map[int][]*types.FileInfo)
+	var rest []*types.FileInfo
+	for _, file := range files {
+		pin := options.pinnedEpisode(file.Path)
+		if pin == "" {
+			rest = append(rest, file)
+			continue
+		}
+		index, _ := parseEpisodeID(pin)
+		pinned[index] = append(pinned[index], file)
+	}
+
+	var plans []*episodePlan
+	for index, group := range pinned {
+		var size int64
+		for _, file := range group {
+			size += file.Size
+		}
+		if size > options.maxPackageSize {
+			return nil, fmt.Errorf("%w: 固定到分集 %s 的文件共 %d 字节，超过包大小上限", ErrInvalidPlanEdit, episodeID(index), size)
+		}
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].Path < group[j].Path
+		})
+		plans = append(plans, &episodePlan{episode: createEpisode(index, group, size), files: group})
+	}
+
+	taken := make(map[int]bool, len(pinned))
+	for index := range pinned {
+		taken[index] = true
+	}
+	var partStart int
+	for _, bin := range packEpisodes(rest, options.maxPackageSize) {
+		var index int
+		switch {
+		case bin.part == nil:
+			index = firstFreeRun(taken, 1)
+		case bin.part.Index == 1:
+			partStart = firstFreeRun(taken, bin.partCount)
+			for i := partStart; i < partStart+bin.partCount; i++ {
+				taken[i] = true
+			}
+			index = partStart
+		default:
+			index = partStart + bin.part.Index - 1
+		}
+		taken[index] = true
+		episode := createEpisode(index, bin.files, bin.size)
+		if bin.part != nil {
+			bin.part.EpisodeID = episode.ID
+			episode.SplitFile = bin.files[0].Path
+			episode.PartIndex = bin.part.Index
+			episode.PartCount = bin.partCount
+		}
+		plans = append(plans, &episodePlan{episode: episode, files: bin.files, part: bin.part})
+	}
+
+	sort.Slice(plans, func(i, j int) bool {
+		a, _ := parseEpisodeID(plans[i].episode.ID)
+		b, _ := parseEpisodeID(plans[j].episode.ID)
+		return a < b
+	})
+	return plans, nil
+}
+
+// firstFreeRun 返回第一段长度为 count 的连续空闲分集编号的起点
+func firstFreeRun(taken map[int]bool, count int) int {
+	for start := 1; ; start++ {
+		free := true
+		for i := start; i < start+count; i++ {
+			if taken[i] {
+				free = false
+				start = i
+				break
+			}
+		}
+		if free {
+			return start
+		}
+	}
+}
+
+// effectiveDeletions 返回本次运行要从清单中移除的文件，被用户排除的删除留待下次运行
+func effectiveDeletions(plan *types.BackupPlan) []string {
+	options := optionsOf(plan)
+	deletions := make([]string, 0, len(plan.DeletedFiles))
+	for _, path := range plan.DeletedFiles {
+		if !options.isExcluded(path) {
+			deletions = append(deletions, path)
+		}
+	}
+	return deletions
+}
+
+// effectiveMetadataChanges 返回本次运行要更新元数据的文件，被用户排除的留待下次运行
+func effectiveMetadataChanges(plan *types.BackupPlan) []*types.FileInfo {
+	options := optionsOf(plan)
+	changes := make([]*types.FileInfo, 0, len(plan.MetadataFiles))
+	for _, file := range plan.MetadataFiles {
+		if !options.isExcluded(file.Path) {
+			changes = append(changes, file)
+		}
+	}
+	return changes
+}
+
+// manifestFingerprint 返回清单的标识，用于判断计划生成后是否又执行过备份
+// 尚无任何文件记录的清单（首次备份）统一视为同一个空清单
+func manifestFingerprint(manifest *types.Manifest) string {
+	if len(manifest.Files) == 0 {
+		return ""
+	}
+	return manifest.CreatedAt.UTC().Format(time.RFC3339Nano)
+}
+
+// resolvePlan 校验计划在当前工作区中仍然有效，并以当前扫描到的文件重建分集规划
+// 计划生成后清单被更新、计划内的文件被修改或删除（只更新元数据的文件元数据再次变化）、计划删除的文件重新出现，都会使计划失效；
+// 计划之外新出现的变更不影响计划，留待下次运行处理
+func resolvePlan(plan *types.BackupPlan, previous *types.Manifest, currentFiles map[string]*types.FileInfo) ([]*episodePlan, error) {
+	if manifestFingerprint(previous) != plan.BaseManifest {
+		return nil, fmt.Errorf("%w: 计划生成后已执行过其他备份，请重新扫描", ErrPlanInvalidated)
+	}
+
+	var changed []string
+	resolved := make(map[string]*types.FileInfo)
+	plans := make([]*episodePlan, 0, len(plan.Episodes))
+	for _, planned := range plan.Episodes {
+		files := make([]*types.FileInfo, 0, len(planned.Files))
+		for _, file := range planned.Files {
+			current, exists := resolved[file.Path]
+			if !exists {
+				current = currentFiles[file.Path]
+				if current == nil || current.Size != file.Size || !current.ModTime.Equal(file.ModTime) {
+					changed = append(changed, file.Path)
+					continue
+				}
+				current.Status = file.Status
+				resolved[file.Path] = current
+			}
+			files = append(files, current)
+		}
+		plans = append(plans, &episodePlan{episode: planned.Episode, files: files, part: planned.Part})
+	}
+	for _, path := range effectiveDeletions(plan) {
+		if _, exists := currentFiles[path]; exists {
+			changed = append(changed, path)
+		}
+	}
+	for _, file := range effectiveMetadataChanges(plan) {
+		current := currentFiles[file.Path]
+		if current == nil || current.Size != file.Size || !current.ModTime.Equal(file.ModTime) || indexer.PosixChanged(current.Posix, file.Posix) {
+			changed = append(changed, file.Path)
+		}
+	}
+
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		more := ""
+		if len(changed) > maxReportedPaths {
+			more = fmt.Sprintf(" 等 %d 个文件", len(changed))
+			changed = changed[:maxReportedPaths]
+		}
+		return nil, fmt.Errorf("%w: 文件已发生变化，请重新扫描: %s%s", ErrPlanInvalidated, strings.Join(changed, ", "), more)
+	}
+	return plans, nil
+}
@@ -0,0 +1,134 @@
+package task_manager
+
+import (
+	"beanckup/backend/types"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// ExcludePlanPath 将文件或目录排除在计划之外，返回重新规划后的结果
+func (m *Manager) ExcludePlanPath(workspacePath, planID, path string) (*types.BackupPreparationResult, error) {
+	return m.editPlan(workspacePath, planID, func(plan *types.BackupPlan) error {
+		path = filepath.Clean(path)
+		plan.Excluded = append(removeRules(plan.Excluded, path), path)
+		plan.Included = removeRules(plan.Included, path)
+		return nil
+	})
+}
+
+// IncludePlanPath 将之前排除的文件或目录重新纳入计划，返回重新规划后的结果
+func (m *Manager) IncludePlanPath(workspacePath, planID, path string) (*types.BackupPreparationResult, error) {
+	return m.editPlan(workspacePath, planID, func(plan *types.BackupPlan) error {
+		path = filepath.Clean(path)
+		plan.Excluded = removeRules(plan.Excluded, path)
+		plan.Included = removeRules(plan.Included, path)
+		// 上级目录仍被排除时，需要一条更具体的纳入规则
+		if optionsOf(plan).isExcluded(path) {
+			plan.Included = append(plan.Included, path)
+		}
+		return nil
+	})
+}
+
+// AssignPlanPath 将文件或目录固定分配到指定分集，返回重新规划后的结果
+// 固定到同一分集的文件总量不能超过包大小上限，超大文件的分卷不能固定
+func (m *Manager) AssignPlanPath(workspacePath, planID, path, episodeID string) (*types.BackupPreparationResult, error) {
+	if _, ok := parseEpisodeID(episodeID); !ok {
+		return nil, fmt.Errorf("%w: 分集ID格式不正确: %s", ErrInvalidPlanEdit, episodeID)
+	}
+	return m.editPlan(workspacePath, planID, func(plan *types.BackupPlan) error {
+		path = filepath.Clean(path)
+		if plan.Pins == nil {
+			plan.Pins = make(map[string]string)
+		}
+		for pinned := range plan.Pins {
+			if underPath(pinned, path) {
+				delete(plan.Pins, pinned)
+			}
+		}
+		plan.Pins[path] = episodeID
+		return nil
+	})
+}
+
+// RebalancePlan 清除所有固定分配，按确定性装箱重新规划，排除规则保持不变
+func (m *Manager) RebalancePlan(workspacePath, planID string) (*types.BackupPreparationResult, error) {
+	return m.editPlan(workspacePath, planID, func(plan *types.BackupPlan) error {
+		plan.Pins = nil
+		return nil
+	})
+}
+
+// editPlan 读取计划、应用编辑、重新规划并保存，编辑无法满足时计划保持不变
+func (m *Manager) editPlan(workspacePath, planID string, edit func(plan *types.BackupPlan) error) (*types.BackupPreparationResult, error) {
+	m.mu.Lock()
+	running := m.isRunning
+	m.mu.Unlock()
+	if running {
+		return nil, ErrTaskAlreadyRunning
+	}
+
+	plan, err := m.planManager.LoadPlan(workspacePath, planID)
+	if err != nil {
+		return nil, err
+	}
+	if err := edit(plan); err != nil {
+		return nil, err
+	}
+	plans, err := replan(plan)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.planManager.SavePlan(plan); err != nil {
+		return nil, fmt.Errorf("保存备份计划失败: %w", err)
+	}
+
+	log.Printf("Task Manager: Plan %s edited: %d episodes, %d excluded, %d deferred.", plan.ID, len(plans), plan.ChangeInfo.ExcludedCount, plan.ChangeInfo.DeferredCount)
+	return preparationResult(plan, plans), nil
+}
+
+// isExcluded 判断文件是否被用户排除，排除与纳入规则中最具体（最长）的一条生效
+func (o *planOptions) isExcluded(path string) bool {
+	excluded := matchLength(path, o.excluded)
+	return excluded >= 0 && excluded > matchLength(path, o.included)
+}
+
+// pinnedEpisode 返回文件被固定分配到的分集ID，最具体的规则生效，未固定时返回空
+func (o *planOptions) pinnedEpisode(path string) string {
+	best, episodeID := -1, ""
+	for pinned, id := range o.pins {
+		if underPath(path, pinned) && len(pinned) > best {
+			best, episodeID = len(pinned), id
+		}
+	}
+	return episodeID
+}
+
+// matchLength 返回 rules 中覆盖 path 的最长规则的长度，没有规则覆盖时返回 -1
+func matchLength(path string, rules []string) int {
+	best := -1
+	for _, rule := range rules {
+		if underPath(path, rule) && len(rule) > best {
+			best = len(rule)
+		}
+	}
+	return best
+}
+
+// removeRules 移除等于 path 或位于 path 之下的规则
+func removeRules(rules []string, path string) []string {
+	kept := rules[:0]
+	for _, rule := range rules {
+		if !underPath(rule, path) {
+			kept = append(kept, rule)
+		}
+	}
+	return kept
+}
+
+// underPath 判断 path 是否等于 dir 或位于 dir 之下
+func underPath(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
@@ -0,0 +1,71 @@
+package task_manager
+
+import (
+	"beanckup/backend/types"
+	"fmt"
+	"log"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+const (
+	// archiveBytesPerFile 每个文件在交付包中的结构开销（本地文件头、数据描述符、中央目录项）
+	archiveBytesPerFile = 256
+
+	// manifestBytesPerFile 每个文件在清单中占用的大致字节数
+	manifestBytesPerFile = 512
+
+	// spaceWarningRatio 可用空间低于预估需求的该倍数时给出警告
+	spaceWarningRatio = 1.1
+)
+
+// checkDeliverySpace 在开始任何打包工作之前检查交付路径所在卷的剩余空间
+// 预估需求按未压缩大小计算（不可压缩的数据在归档后不会变小），并加上归档结构、恢复数据和清单的开销；
+// 空间不足时返回 ErrInsufficientSpace，余量不足 10% 时只给出警告
+func (m *Manager) checkDeliverySpace(deliveryPath string, plans []*episodePlan, manifestFileCount int) (*types.SpaceCheck, error) {
+	var required int64
+	var fileCount int
+	for _, plan := range plans {
+		required += plan.episode.EstimatedSize
+		fileCount += len(plan.files)
+	}
+	required += int64(fileCount) * archiveBytesPerFile
+	required += required * int64(m.parityRedundancySetting()) / 100
+	required += int64(manifestFileCount+fileCount) * manifestBytesPerFile
+
+	usage, err := disk.Usage(deliveryPath)
+	if err != nil {
+		return nil, fmt.Errorf("查询交付路径剩余空间失败: %w", err)
+	}
+
+	check := &types.SpaceCheck{
+		DeliveryPath:  deliveryPath,
+		FreeBytes:     int64(usage.Free),
+		RequiredBytes: required,
+		Sufficient:    int64(usage.Free) >= required,
+	}
+	log.Printf("Task Manager: Delivery space preflight: %d bytes free, %d bytes required.", check.FreeBytes, check.RequiredBytes)
+
+	if !check.Sufficient {
+		return check, fmt.Errorf("%w: 需要 %s，可用 %s（%s）", ErrInsufficientSpace, formatSize(required), formatSize(check.FreeBytes), deliveryPath)
+	}
+	if float64(check.FreeBytes) < float64(required)*spaceWarningRatio {
+		check.Warning = fmt.Sprintf("交付路径剩余空间紧张：需要约 %s，可用 %s，压缩率低于预期时可能写满", formatSize(required), formatSize(check.FreeBytes))
+		log.Printf("Task Manager: %s", check.Warning)
+	}
+	return check, nil
+}
+
+// formatSize 将字节数格式化为便于阅读的字符串
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,297 @@
+package task_manager
+
+import (
+	"beanckup/backend/encryptor"
+	"beanckup/backend/parity"
+	"beanckup/backend/series_manager"
+	"beanckup/backend/signer"
+	"beanckup/backend/types"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RotateKeys 轮换交付路径中原生加密的交付包与清单的密钥
+// 用旧密码与当前的密钥文件、私钥解开每个文件的数据密钥，再为新密码、当前的密钥文件与公钥重新封装；只重写加密头部，密文不变
+// 重写后的交付包会更新系列登记中的校验和，并重新生成已有的恢复数据；7z 加密与未加密的交付包保持不变
+// 交付路径有清单链时，新的校验和用工作区的签名密钥在清单链末尾追加的密钥轮换项中重新登记，因此需要能访问工作区的签名密钥
+// 全部轮换成功后系列的密码校验值随之更新为新密码
+func (m *Manager) RotateKeys(deliveryPath, oldPassword, newPassword string, ctx context.Context) (*types.KeyRotationReport, error) {
+	if err := m.beginTask(ctx); err != nil {
+		return nil, err
+	}
+	defer m.endTask()
+
+	log.Printf("Task Manager: Rotating keys of delivery path %s", deliveryPath)
+	verifier, err := newPasswordVerifier(newPassword)
+	if err != nil {
+		return nil, err
+	}
+	report, err := m.rotateKeys(deliveryPath, oldPassword, newPassword, verifier)
+	if err != nil {
+		log.Printf("Task Manager: Key rotation failed: %v", err)
+		return nil, err
+	}
+	log.Printf("Task Manager: Key rotation finished: %d rotated, %d skipped, %d failed.", report.RotatedCount, len(report.Skipped), len(report.Failed))
+	return report, nil
+}
+
+// ChangePassword 修改系列的密码：用系列的校验值确认旧密码，指定交付路径时先轮换其中的交付包与清单，再记录新密码的校验值
+// newPassword 为空表示取消密码；交付路径中仍有交付包未能轮换时保留旧的校验值，返回的报告列出失败的交付包
+// 未指定交付路径时只修改校验值，适用于之后改用新的交付路径，原交付路径中的交付包仍需旧密码还原
+func (m *Manager) ChangePassword(workspacePath, deliveryPath, oldPassword, newPassword string, ctx context.Context) (*types.KeyRotationReport, error) {
+	if err := m.beginTask(ctx); err != nil {
+		return nil, err
+	}
+	defer m.endTask()
+
+	log.Printf("Task Manager: Changing password of workspace %s", workspacePath)
+	series, err := m.seriesManager.LoadSeries(workspacePath, "")
+	if err != nil {
+		return nil, err
+	}
+	oldKeys := encryptor.NewKeyring(oldPassword, encryptor.KeySources{})
+	defer oldKeys.Wipe()
+	if err := verifySeriesPassword(series, oldKeys); err != nil {
+		return nil, fmt.Errorf("旧密码校验失败: %w", err)
+	}
+	verifier, err := newPasswordVerifier(newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &types.KeyRotationReport{Skipped: []string{}, Failed: []string{}}
+	if deliveryPath != "" {
+		report, err = m.rotateKeys(deliveryPath, oldPassword, newPassword, verifier)
+		if err != nil {
+			log.Printf("Task Manager: Password change failed: %v", err)
+			return nil, err
+		}
+		if len(report.Failed) > 0 {
+			log.Printf("Task Manager: Password not changed, %d archives failed to rotate.", len(report.Failed))
+			return report, nil
+		}
+		// 轮换可能已更新工作区中的登记（校验和与加密信息），重新读取后再记录校验值
+		if series, err = m.seriesManager.LoadSeries(workspacePath, ""); err != nil {
+			return nil, err
+		}
+	}
+	series.PasswordVerifier = verifier
+	if err := m.seriesManager.SaveSeries(workspacePath, "", series); err != nil {
+		return nil, err
+	}
+	log.Printf("Task Manager: Password changed for series %s.", series.ID)
+	return report, nil
+}
+
+// rotateKeys 是密钥轮换的主体，全部轮换成功后将 verifier 记录为系列的密码校验值
+func (m *Manager) rotateKeys(deliveryPath, oldPassword, newPassword string, verifier *types.PasswordVerifier) (*types.KeyRotationReport, error) {
+	m.mu.Lock()
+	sources := m.keySources
+	m.mu.Unlock()
+
+	// 解密一方使用旧密码、密钥文件与私钥；加密一方使用新密码、密钥文件与公钥
+	openKeys := encryptor.NewKeyring(oldPassword, encryptor.KeySources{Keyfiles: sources.Keyfiles, Identities: sources.Identities})
+	defer openKeys.Wipe()
+	sealKeys := encryptor.NewKeyring(newPassword, encryptor.KeySources{Keyfiles: sources.Keyfiles, Recipients: sources.Recipients})
+	defer sealKeys.Wipe()
+	// 已用新密钥加密的交付包（上次轮换中途失败时留下）直接跳过
+	rotatedKeys := encryptor.NewKeyring(newPassword, encryptor.KeySources{Keyfiles: sources.Keyfiles, Identities: sources.Identities})
+	defer rotatedKeys.Wipe()
+	recipients, err := sealKeys.Recipients()
+	if err != nil {
+		return nil, fmt.Errorf("%w: 轮换后没有可用的密码、密钥文件或公钥", ErrInvalidConfig)
+	}
+
+	// 先用旧密钥打开清单，确认旧密钥有效后才开始改写交付包
+	manifest, err := m.manifestManager.LoadDeliveryManifest(deliveryPath, openKeys)
+	if err != nil {
+		return nil, fmt.Errorf("加载交付清单失败: %w", err)
+	}
+	series, err := m.seriesManager.LoadDeliverySeries(deliveryPath)
+	if err != nil && !errors.Is(err, series_manager.ErrSeriesNotFound) {
+		return nil, err
+	}
+	chain, key, err := m.loadRotationChain(deliveryPath, manifest)
+	if err != nil {
+		return nil, err
+	}
+	signed := signer.Episodes(chain)
+
+	report := &types.KeyRotationReport{
+		DeliveryPath: deliveryPath,
+		Skipped:      []string{},
+		Failed:       []string{},
+	}
+	ids := make([]string, 0, len(manifest.Packages))
+	for id := range manifest.Packages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	type rotated struct {
+		checksum string
+		info     *types.EncryptionInfo
+	}
+	results := make(map[string]rotated)
+	for _, id := range ids {
+		name := manifest.Packages[id]
+		if !strings.HasSuffix(name, encryptor.Suffix) {
+			report.Skipped = append(report.Skipped, name)
+			continue
+		}
+		packagePath := filepath.Join(deliveryPath, name)
+		info, err := encryptor.RewrapFile(packagePath, openKeys, recipients)
+		if errors.Is(err, encryptor.ErrWrongPassword) && canOpen(packagePath, rotatedKeys) {
+			report.Skipped = append(report.Skipped, name)
+			// 上次轮换在登记清单链之前中断时，补登记当前的校验和
+			if episode := signed[id]; episode != nil {
+				if checksum, err := m.verifier.Checksum(packagePath); err == nil && checksum != episode.Checksum {
+					results[id] = rotated{checksum: checksum}
+				}
+			}
+			continue
+		}
+		if err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		checksum, err := m.verifier.Checksum(packagePath)
+		if err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		results[id] = rotated{checksum: checksum, info: info}
+		report.RotatedCount++
+	}
+
+	// 交付包重写后恢复数据失效，按原冗余比例重新生成
+	if series != nil {
+		for _, episode := range series.Episodes {
+			result, ok := results[episode.ID]
+			if !ok || episode.ParityFile == "" {
+				continue
+			}
+			packagePath := filepath.Join(deliveryPath, manifest.Packages[episode.ID])
+			os.Remove(packagePath + parity.Suffix)
+			if _, err := m.parity.Create(packagePath, result.checksum, episode.Redundancy); err != nil {
+				report.Failed = append(report.Failed, fmt.Sprintf("%s: 重新生成恢复数据失败: %v", filepath.Base(packagePath), err))
+			}
+		}
+	}
+
+	// 在清单链中重新登记改变了校验和的交付包，之后才轮换清单：登记失败时清单仍可用旧密钥打开，重新执行时补登记
+	if key != nil && len(results) > 0 {
+		checksums := make(map[string]string, len(results))
+		for id, result := range results {
+			checksums[id] = result.checksum
+		}
+		err = m.signRotation(key, chain, manifest.WorkspacePath, deliveryPath, checksums)
+	}
+
+	// 清单最后轮换：交付包轮换中途失败时，清单仍可用旧密钥打开，排除问题后可重新执行
+	complete := len(report.Failed) == 0 && err == nil
+	if complete {
+		err = m.manifestManager.RewrapDeliveryManifest(deliveryPath, openKeys, recipients)
+		if errors.Is(err, encryptor.ErrNotEncrypted) {
+			err = nil
+		}
+		complete = err == nil
+	}
+	if series != nil {
+		m.updateSeries(series, manifest.WorkspacePath, deliveryPath, func(series *types.Series) {
+			for _, episode := range series.Episodes {
+				if result, ok := results[episode.ID]; ok {
+					episode.Checksum = result.checksum
+					if result.info != nil {
+						episode.Encryption = result.info
+					}
+				}
+			}
+			if complete {
+				series.PasswordVerifier = verifier
+			}
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if complete {
+		report.Encryption = encryptor.Info(recipients)
+	}
+	return report, nil
+}
+
+// loadRotationChain 读取交付路径的清单链；清单链不为空时读取工作区的签名密钥，并在改写交付包之前确认清单与清单链未被篡改，
+// 避免为被篡改的清单链续签；没有清单链（签名功能启用前的交付）时返回的密钥为 nil，轮换不登记清单链
+func (m *Manager) loadRotationChain(deliveryPath string, manifest *types.Manifest) (*types.ManifestChain, *signer.Key, error) {
+	chain, err := m.manifestManager.LoadDeliveryChain(deliveryPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(chain.Entries) == 0 {
+		return chain, nil, nil
+	}
+	key, err := signer.LoadKey(manifest.WorkspacePath)
+	if os.IsNotExist(err) {
+		err = fmt.Errorf("%w: 轮换会改变交付包的校验和，需要用工作区 %s 的签名密钥在清单链中重新登记", signer.ErrKeyNotFound, manifest.WorkspacePath)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	report := signer.Verify(chain, manifest, key.PublicKey())
+	if len(report.Problems) > 0 {
+		return nil, nil, fmt.Errorf("%w: %s", signer.ErrChainBroken, strings.Join(report.Problems, "; "))
+	}
+	return chain, key, nil
+}
+
+// signRotation 在交付路径与工作区的清单链末尾追加密钥轮换项，登记交付包轮换后的校验和
+// 工作区的清单链为空（工作区已不可访问或未签名）时只更新交付路径中的清单链
+func (m *Manager) signRotation(key *signer.Key, chain *types.ManifestChain, workspacePath, deliveryPath string, checksums map[string]string) error {
+	registered := signer.Episodes(chain)
+	ids := make([]string, 0, len(checksums))
+	for id := range checksums {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	episodes := make([]*types.ChainEpisode, 0, len(ids))
+	for _, id := range ids {
+		episode := *registered[id]
+		episode.Checksum = checksums[id]
+		episodes = append(episodes, &episode)
+	}
+
+	if err := key.AppendRotation(chain, episodes); err != nil {
+		return err
+	}
+	if err := m.manifestManager.SaveChain("", deliveryPath, chain); err != nil {
+		return fmt.Errorf("登记密钥轮换失败: %w", err)
+	}
+	local, err := m.manifestManager.LoadChain(workspacePath)
+	if err != nil || len(local.Entries) == 0 {
+		return nil
+	}
+	if err := key.AppendRotation(local, episodes); err != nil {
+		return err
+	}
+	if err := m.manifestManager.SaveChain(workspacePath, "", local); err != nil {
+		return fmt.Errorf("登记密钥轮换失败: %w", err)
+	}
+	return nil
+}
+
+// canOpen 判断加密文件能否用指定的密钥环打开
+func canOpen(path string, keys *encryptor.Keyring) bool {
+	file, err := encryptor.OpenFile(path, keys)
+	if err != nil {
+		return false
+	}
+	file.Close()
+	return true
+}
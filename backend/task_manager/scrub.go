@@ -0,0 +1,237 @@
+package task_manager
+
+import (
+	"beanckup/backend/encryptor"
+	"beanckup/backend/series_manager"
+	"beanckup/backend/signer"
+	"beanckup/backend/types"
+	"beanckup/backend/verifier"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ScrubDelivery 定期校验交付路径中的全部交付包，检测外部存储上的数据损坏
+// 快速模式比对交付包文件的 SHA-256 与清单链中签名的校验和（清单链未记录时使用系列登记中的校验和，都未记录时只检查能否打开并列出条目），
+// 深度模式解压并重新计算清单引用的每个条目的哈希；同时报告缺失的交付包、未被清单引用的交付包，以及清单签名与清单链的问题
+// trustedKey 为受信任的签名公钥，为空时签名者报告为未经确认
+func (m *Manager) ScrubDelivery(deliveryPath string, deep bool, password, trustedKey string, ctx context.Context) (*types.ScrubReport, error) {
+	if err := m.beginTask(ctx); err != nil {
+		return nil, err
+	}
+	defer m.endTask()
+
+	log.Printf("Task Manager: Scrubbing delivery path %s (deep: %v)", deliveryPath, deep)
+	report, err := m.scrub(deliveryPath, deep, password, trustedKey)
+	if err != nil {
+		log.Printf("Task Manager: Scrub failed: %v", err)
+		return nil, err
+	}
+	log.Printf("Task Manager: Scrub finished: %d passed, %d missing, %d corrupt, %d orphaned, %d integrity problems.", report.CheckedCount, len(report.Missing), len(report.Corrupt), len(report.Orphaned), len(report.Integrity.Problems))
+	return report, nil
+}
+
+// scrub 是交付路径校验的主体
+func (m *Manager) scrub(deliveryPath string, deep bool, password, trustedKey string) (*types.ScrubReport, error) {
+	keys := m.newKeyring(password)
+	defer keys.Wipe()
+	manifest, err := m.manifestManager.LoadDeliveryManifest(deliveryPath, keys)
+	if err != nil {
+		return nil, fmt.Errorf("加载交付清单失败: %w", err)
+	}
+	// 系列登记是可选的：较早的交付路径中没有登记，此时快速模式只能检查交付包能否打开
+	series, err := m.seriesManager.LoadDeliverySeries(deliveryPath)
+	if err != nil && !errors.Is(err, series_manager.ErrSeriesNotFound) {
+		return nil, err
+	}
+	records := make(map[string]*types.Episode)
+	checksums := make(map[string]string)
+	if series != nil {
+		for _, episode := range series.Episodes {
+			records[episode.ID] = episode
+			checksums[episode.ID] = episode.Checksum
+		}
+	}
+	// 系列登记没有签名，清单链中登记了校验和时以签名的为准；清单链本身的问题由完整性校验报告
+	if chain, err := m.manifestManager.LoadDeliveryChain(deliveryPath); err == nil {
+		for id, episode := range signer.Episodes(chain) {
+			if episode.Checksum != "" {
+				checksums[id] = episode.Checksum
+			}
+		}
+	}
+
+	report := &types.ScrubReport{
+		DeliveryPath: deliveryPath,
+		Deep:         deep,
+		StartedAt:    time.Now(),
+		Missing:      []string{},
+		Corrupt:      []*types.ArchiveVerification{},
+		Orphaned:     []string{},
+	}
+
+	ids := make([]string, 0, len(manifest.Packages))
+	referenced := make(map[string]bool, len(manifest.Packages))
+	var totalSize int64
+	for id, name := range manifest.Packages {
+		ids = append(ids, id)
+		referenced[name] = true
+		if info, err := os.Stat(filepath.Join(deliveryPath, name)); err == nil {
+			totalSize += info.Size()
+		}
+	}
+	sort.Strings(ids)
+
+	entries := scrubEntries(manifest)
+	results := make(map[string][]string, len(ids)) // 分集ID到发现的问题，空表示校验通过
+	progress := newProgressTracker(m, totalSize)
+	progress.report("校验中")
+	for _, id := range ids {
+		name := manifest.Packages[id]
+		packagePath := filepath.Join(deliveryPath, name)
+		record := records[id]
+		if record != nil && record.Status == types.EpisodePruned {
+			continue
+		}
+
+		info, err := os.Stat(packagePath)
+		if err != nil {
+			report.Missing = append(report.Missing, name)
+			results[id] = []string{fmt.Sprintf("交付包不存在: %s", name)}
+			continue
+		}
+
+		var verification *types.ArchiveVerification
+		switch {
+		case deep:
+			verification = m.verifier.VerifyEntries(packagePath, entries[id], keys)
+		case checksums[id] != "":
+			verification = m.verifier.VerifyChecksum(packagePath, checksums[id])
+		default:
+			verification = m.verifier.VerifyEntries(packagePath, nil, keys)
+		}
+		progress.advance(info.Size())
+
+		results[id] = verification.Problems
+		if len(verification.Problems) > 0 {
+			report.Corrupt = append(report.Corrupt, verification)
+			continue
+		}
+		report.CheckedCount++
+	}
+
+	orphaned, err := orphanedArchives(deliveryPath, referenced)
+	if err != nil {
+		return nil, err
+	}
+	report.Orphaned = orphaned
+	report.Integrity = m.verifyDeliveryIntegrity(deliveryPath, manifest, trustedKey)
+	report.FinishedAt = time.Now()
+
+	if series != nil {
+		m.recordChecks(series, manifest.WorkspacePath, deliveryPath, results)
+	}
+	return report, nil
+}
+
+// scrubEntries 按分集整理清单引用的条目：普通文件与去重文件指向同一条目时只校验一次，分卷文件校验每个分卷
+func scrubEntries(manifest *types.Manifest) map[string][]verifier.Entry {
+	entries := make(map[string][]verifier.Entry)
+	seen := make(map[string]bool)
+	add := func(episodeID string, entry verifier.Entry) {
+		key := episodeID + "\x00" + entry.Name
+		if episodeID == "" || entry.Name == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		entries[episodeID] = append(entries[episodeID], entry)
+	}
+
+	paths := make([]string, 0, len(manifest.Files))
+	for path := range manifest.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		file := manifest.Files[path]
+		if len(file.Parts) > 0 {
+			for _, part := range file.Parts {
+				add(part.EpisodeID, verifier.Entry{Name: part.EntryName, Size: part.Size, Hash: part.Hash})
+			}
+			continue
+		}
+		add(file.EpisodeID, verifier.Entry{Name: file.EntryName, Size: file.Size, Hash: file.ContentHash})
+	}
+	return entries
+}
+
+// orphanedArchives 返回交付路径中未被清单引用的交付包
+func orphanedArchives(deliveryPath string, referenced map[string]bool) ([]string, error) {
+	dirEntries, err := os.ReadDir(deliveryPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取交付路径失败: %w", err)
+	}
+	orphaned := []string{}
+	for _, entry := range dirEntries {
+		name := entry.Name()
+		if entry.IsDir() || referenced[name] {
+			continue
+		}
+		if strings.HasSuffix(name, ".zip") || strings.HasSuffix(name, ".7z") || strings.HasSuffix(name, ".zip"+encryptor.Suffix) {
+			orphaned = append(orphaned, name)
+		}
+	}
+	return orphaned, nil
+}
+
+// recordChecks 将校验结果记录到系列登记：通过的分集标记为已校验，缺失或损坏的标记为失败
+func (m *Manager) recordChecks(series *types.Series, workspacePath, deliveryPath string, results map[string][]string) {
+	m.updateSeries(series, workspacePath, deliveryPath, func(series *types.Series) {
+		for _, episode := range series.Episodes {
+			problems, checked := results[episode.ID]
+			if !checked {
+				continue
+			}
+			status := types.EpisodeVerified
+			if len(problems) > 0 {
+				status = types.EpisodeFailed
+			}
+			if err := series_manager.Transition(episode, status); err != nil {
+				log.Printf("Task Manager: Check result of %s not recorded: %v", episode.ID, err)
+				continue
+			}
+			if len(problems) > 0 {
+				episode.Problems = problems
+			}
+		}
+	})
+}
+
+// updateSeries 对交付路径中的系列登记应用修改并保存；工作区仍可访问且属于同一系列时，工作区中的登记也一并修改
+func (m *Manager) updateSeries(series *types.Series, workspacePath, deliveryPath string, apply func(series *types.Series)) {
+	apply(series)
+	if err := m.seriesManager.SaveSeries("", deliveryPath, series); err != nil {
+		log.Printf("Task Manager: Failed to save series to delivery path: %v", err)
+	}
+
+	if workspacePath == "" {
+		return
+	}
+	if _, err := os.Stat(workspacePath); err != nil {
+		return
+	}
+	local, err := m.seriesManager.LoadSeries(workspacePath, "")
+	if err != nil || local.ID != series.ID {
+		return
+	}
+	apply(local)
+	if err := m.seriesManager.SaveSeries(workspacePath, "", local); err != nil {
+		log.Printf("Task Manager: Failed to save series to workspace: %v", err)
+	}
+}
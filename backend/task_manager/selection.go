@@ -0,0 +1,92 @@
+package task_manager
+
+import (
+	"beanckup/backend/types"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// selectForBudget 在本次任务总量上限内挑选要备份的文件，其余推迟到下次运行
+// 文件按策略排序后依次尝试放入预算，放不下的文件跳过，继续尝试后面的文件以尽量用满预算；
+// 推迟的文件不会写入新清单，下次扫描时会再次被识别为变更
+func selectForBudget(files []*types.FileInfo, options *planOptions) (selected, deferred []*types.FileInfo) {
+	ordered := make([]*types.FileInfo, len(files))
+	copy(ordered, files)
+	sortByPolicy(ordered, options)
+
+	// 用户固定到分集的文件优先占用预算
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return options.pinnedEpisode(ordered[i].Path) != "" && options.pinnedEpisode(ordered[j].Path) == ""
+	})
+
+	if options.maxTotalSize <= 0 {
+		return ordered, nil
+	}
+
+	var used int64
+	for _, file := range ordered {
+		if used+file.Size <= options.maxTotalSize {
+			selected = append(selected, file)
+			used += file.Size
+		} else {
+			deferred = append(deferred, file)
+		}
+	}
+	return selected, deferred
+}
+
+// sortByPolicy 按挑选策略对文件排序，相同优先级的文件按路径排序，保证结果确定
+func sortByPolicy(files []*types.FileInfo, options *planOptions) {
+	switch options.policy {
+	case types.PolicySmallestFirst:
+		sort.SliceStable(files, func(i, j int) bool {
+			if files[i].Size != files[j].Size {
+				return files[i].Size < files[j].Size
+			}
+			return files[i].Path < files[j].Path
+		})
+	case types.PolicyFolderPriority:
+		folders := normalizeFolders(options.priorityFolders, options.workspacePath)
+		sort.SliceStable(files, func(i, j int) bool {
+			ri, rj := folderRank(files[i].Path, folders), folderRank(files[j].Path, folders)
+			if ri != rj {
+				return ri < rj
+			}
+			return files[i].Path < files[j].Path
+		})
+	default: // types.PolicyOldestFirst
+		sort.SliceStable(files, func(i, j int) bool {
+			if !files[i].ModTime.Equal(files[j].ModTime) {
+				return files[i].ModTime.Before(files[j].ModTime)
+			}
+			return files[i].Path < files[j].Path
+		})
+	}
+}
+
+// normalizeFolders 将优先文件夹统一为绝对路径，相对路径视为相对于工作区
+func normalizeFolders(folders []string, workspacePath string) []string {
+	normalized := make([]string, 0, len(folders))
+	for _, folder := range folders {
+		folder = strings.TrimSpace(folder)
+		if folder == "" {
+			continue
+		}
+		if !filepath.IsAbs(folder) {
+			folder = filepath.Join(workspacePath, folder)
+		}
+		normalized = append(normalized, filepath.Clean(folder))
+	}
+	return normalized
+}
+
+// folderRank 返回文件所属的第一个优先文件夹的序号，不属于任何优先文件夹的排在最后
+func folderRank(path string, folders []string) int {
+	for i, folder := range folders {
+		if path == folder || strings.HasPrefix(path, folder+string(filepath.Separator)) {
+			return i
+		}
+	}
+	return len(folders)
+}
@@ -0,0 +1,212 @@
+package task_manager
+
+import (
+	"beanckup/backend/encryptor"
+	"beanckup/backend/packager"
+	"beanckup/backend/series_manager"
+	"beanckup/backend/types"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ListSeries 返回工作区的系列登记，包括历次运行产生的全部分集及其生命周期状态
+func (m *Manager) ListSeries(workspacePath string) (*types.Series, error) {
+	manifest, err := m.manifestManager.LoadLatestManifest(workspacePath)
+	if err != nil {
+		return nil, fmt.Errorf("加载清单失败: %w", err)
+	}
+	return m.seriesManager.LoadSeries(workspacePath, manifest.SeriesID)
+}
+
+// UpdateEpisodeStatus 将已交付的分集标记为已归档或已清理，其余状态由备份与校验流程维护
+func (m *Manager) UpdateEpisodeStatus(workspacePath, episodeID, status string) (*types.Episode, error) {
+	if status != types.EpisodeArchived && status != types.EpisodePruned {
+		return nil, fmt.Errorf("%w: 只能标记为%s或%s", series_manager.ErrInvalidTransition, types.EpisodeArchived, types.EpisodePruned)
+	}
+	m.mu.Lock()
+	running := m.isRunning
+	m.mu.Unlock()
+	if running {
+		return nil, ErrTaskAlreadyRunning
+	}
+
+	series, err := m.ListSeries(workspacePath)
+	if err != nil {
+		return nil, err
+	}
+	episode, err := series_manager.FindEpisode(series, episodeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := series_manager.Transition(episode, status); err != nil {
+		return nil, err
+	}
+	if err := m.seriesManager.SaveSeries(workspacePath, "", series); err != nil {
+		return nil, err
+	}
+	log.Printf("Task Manager: Episode %s marked as %s.", episodeID, status)
+	return episode, nil
+}
+
+// SetNamingTemplate 设置工作区的交付包命名模板，保存在系列登记中，为空时恢复默认模板
+// 可用占位符：{series} 系列 ID、{seq} 分集序号（必须包含）、{timestamp} 运行开始时间
+func (m *Manager) SetNamingTemplate(workspacePath, template string) error {
+	if template != "" {
+		if err := series_manager.ValidateNamingTemplate(template); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	running := m.isRunning
+	m.mu.Unlock()
+	if running {
+		return ErrTaskAlreadyRunning
+	}
+
+	series, err := m.ListSeries(workspacePath)
+	if err != nil {
+		return err
+	}
+	series.NamingTemplate = template
+	if err := m.seriesManager.SaveSeries(workspacePath, "", series); err != nil {
+		return err
+	}
+	log.Printf("Task Manager: Naming template of series %s set to %q.", series.ID, template)
+	return nil
+}
+
+// seriesRun 一次备份运行在系列登记中的记录
+// 分集在运行开始时以未交付状态登记；只有新清单保存成功后才变为已交付，运行失败时未交付的分集全部标记为失败
+type seriesRun struct {
+	manager       *Manager
+	workspacePath string
+	series        *types.Series
+	records       map[string]*types.Episode // 分集ID到系列登记中的记录
+	verifier      *types.PasswordVerifier   // 运行成功后保存到系列的密码校验值
+	committed     bool
+}
+
+// startSeriesRun 为本次运行的分集分配全局唯一的分集 ID 与交付包名称，并登记到工作区的系列中
+// 密码与系列的校验值不一致或交付路径中已存在同名交付包时拒绝执行，此时系列登记保持不变
+func (m *Manager) startSeriesRun(workspacePath, deliveryPath string, previous *types.Manifest, planID string, plans []*episodePlan, keys *encryptor.Keyring) (*seriesRun, error) {
+	series, err := m.seriesManager.LoadSeries(workspacePath, previous.SeriesID)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := checkSeriesPassword(series, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &seriesRun{
+		manager:       m,
+		workspacePath: workspacePath,
+		series:        series,
+		records:       make(map[string]*types.Episode, len(plans)),
+		verifier:      verifier,
+	}
+	startedAt := time.Now()
+	assigned := make([]map[string]interface{}, 0, len(plans))
+	for _, plan := range plans {
+		episode := plan.episode
+		plannedID := episode.ID
+		episode.ID, episode.Name = series_manager.NextEpisode(series, startedAt)
+		for _, ext := range []string{".zip", ".7z", ".zip" + encryptor.Suffix} {
+			if _, err := os.Stat(filepath.Join(deliveryPath, episode.Name+ext)); err == nil {
+				return nil, fmt.Errorf("%w: %s", packager.ErrArchiveExists, episode.Name+ext)
+			}
+		}
+		episode.SeriesID = series.ID
+		episode.PlanID = planID
+		if plan.part != nil {
+			plan.part.EpisodeID = episode.ID
+		}
+		record := *episode
+		series.Episodes = append(series.Episodes, &record)
+		run.records[episode.ID] = &record
+		assigned = append(assigned, map[string]interface{}{
+			"plannedId":   plannedID,
+			"episodeId":   episode.ID,
+			"episodeName": episode.Name,
+		})
+	}
+
+	if err := m.seriesManager.SaveSeries(workspacePath, "", series); err != nil {
+		return nil, err
+	}
+	// 预处理时分集使用计划内的编号，通知前端更新为正式的分集 ID 与名称
+	for _, data := range assigned {
+		m.emit("episode-assigned", data)
+	}
+	return run, nil
+}
+
+// begin 记录分集开始打包
+func (r *seriesRun) begin(episode *types.Episode) {
+	series_manager.Transition(r.records[episode.ID], types.EpisodePacking)
+}
+
+// record 记录分集的打包与校验结果
+func (r *seriesRun) record(episode *types.Episode) {
+	record := r.records[episode.ID]
+	record.CreatedAt = episode.CreatedAt
+	record.PackagePath = episode.PackagePath
+	record.FileCount = episode.FileCount
+	record.TotalSize = episode.TotalSize
+	record.Checksum = episode.Checksum
+	record.Problems = episode.Problems
+	record.ParityFile = episode.ParityFile
+	record.Redundancy = episode.Redundancy
+	record.Encryption = episode.Encryption
+}
+
+// manifestSaved 在新清单保存后调用：清单已引用本次运行的分集，之后即使登记系列失败，abort 也不再将它们标记为失败
+func (r *seriesRun) manifestSaved() {
+	r.committed = true
+}
+
+// commit 新清单保存成功后将本次运行的分集标记为已交付（打包后校验通过的标记为已校验），
+// 记录密码校验值，并将系列登记同时保存到交付路径
+// 某个分集的状态无法变更时仍继续处理其余分集并保存系列登记，返回遇到的全部错误
+func (r *seriesRun) commit(deliveryPath string, manifest *types.Manifest, episodes []*types.Episode) error {
+	var errs []error
+	for _, episode := range episodes {
+		record := r.records[episode.ID]
+		if err := series_manager.Transition(record, types.EpisodeDelivered); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if episode.VerifiedAt != nil {
+			if err := series_manager.Transition(record, types.EpisodeVerified); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	r.series.FileCount = len(manifest.Files)
+	r.series.TotalSize = 0
+	for _, file := range manifest.Files {
+		r.series.TotalSize += file.Size
+	}
+	r.series.PasswordVerifier = r.verifier
+	if err := r.manager.seriesManager.SaveSeries(r.workspacePath, deliveryPath, r.series); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// abort 运行失败时将本次运行尚未交付的分集标记为失败
+func (r *seriesRun) abort() {
+	if r.committed {
+		return
+	}
+	for _, record := range r.records {
+		series_manager.Transition(record, types.EpisodeFailed)
+	}
+	if err := r.manager.seriesManager.SaveSeries(r.workspacePath, "", r.series); err != nil {
+		log.Printf("Task Manager: Failed to save series after aborted run: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package task_manager
+
+import (
+	"beanckup/backend/packager"
+	"beanckup/backend/throttle"
+	"beanckup/backend/types"
+	"beanckup/backend/worker"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// splitState 超大文件跨分集分卷打包时的状态
+type splitState struct {
+	hasher *worker.HashingReader // 整个文件的哈希，随各分卷的读取依次累积
+	parts  []*types.FilePart
+	skip   bool // 内容已存在或读取失败，其余分卷不再打包
+}
+
+// executePart 执行承载超大文件一个分卷的分集
+// 各分卷按顺序读取原文件的对应区间，分卷哈希与整个文件的哈希在同一次读取中计算；
+// 最后一个分卷完成后，文件才以完整的分卷列表写入清单
+func (m *Manager) executePart(plan *episodePlan, workspacePath, deliveryPath string, enc *archiveEncryption, index *contentIndex, splits map[string]*splitState, progress *progressTracker) (*episodeOutcome, error) {
+	episode := plan.episode
+	file := plan.files[0]
+	part := plan.part
+	episode.Status = types.EpisodePacking
+	episode.CreatedAt = time.Now()
+	m.emitEpisodeStatus(episode)
+	log.Printf("Task Manager: Packing episode %s with part %d/%d of %s.", episode.Name, part.Index, episode.PartCount, file.Path)
+
+	outcome := &episodeOutcome{}
+	state, exists := splits[file.Path]
+	if !exists {
+		state = m.startSplit(file, index, progress)
+		splits[file.Path] = state
+	}
+	lastPart := part.Index == episode.PartCount
+
+	if state.skip {
+		if lastPart && file.ContentHash != "" && index.has(file.ContentHash) {
+			copyLocation(file, index.byHash[file.ContentHash])
+			outcome.duplicates = append(outcome.duplicates, file)
+		}
+		progress.advance(part.Size)
+		m.finishEpisode(episode, "", outcome)
+		return outcome, nil
+	}
+
+	progress.report("压缩中")
+	entryName := fmt.Sprintf("%s.part%03d", packager.EntryName(file.Path, workspacePath), part.Index)
+	targetPath, partHash, err := m.writePart(file, part, entryName, filepath.Join(deliveryPath, episode.Name), enc, state.hasher)
+	if err != nil {
+		return nil, err
+	}
+	part.EntryName = entryName
+	part.Hash = partHash
+	state.parts = append(state.parts, part)
+	outcome.written = part.Size
+	progress.advance(part.Size)
+
+	if lastPart {
+		if state.hasher.Size() != file.Size {
+			return nil, fmt.Errorf("%w: %s", ErrFileChanged, file.Path)
+		}
+		sum := state.hasher.Sum()
+		if file.ContentHash != "" && file.ContentHash != sum {
+			return nil, fmt.Errorf("%w: %s", ErrFileChanged, file.Path)
+		}
+		file.ContentHash = sum
+		file.Parts = state.parts
+		file.EpisodeID = state.parts[0].EpisodeID
+		file.EntryName = packager.EntryName(file.Path, workspacePath)
+		index.add(file)
+		outcome.packed = append(outcome.packed, file)
+	}
+
+	m.finishEpisode(episode, targetPath, outcome)
+	return outcome, nil
+}
+
+// startSplit 开始打包一个超大文件：大小与已知内容相同时先计算整个文件的哈希，内容已存在则跳过全部分卷
+func (m *Manager) startSplit(file *types.FileInfo, index *contentIndex, progress *progressTracker) *splitState {
+	state := &splitState{hasher: worker.NewHashingReader(nil)}
+	if !index.sizes[file.Size] {
+		return state
+	}
+
+	progress.report("计算哈希")
+	task := &types.ProcessingTask{FileInfo: file, Path: file.Path, Type: types.TaskTypeLargeFile}
+	result := m.worker.HashTasks([]*types.ProcessingTask{task}, index.has)[0]
+	if result.Error != nil {
+		// 读取失败的文件不写入清单，下次运行时会被重新识别为变更
+		log.Printf("Task Manager: Skipping file: %v", result.Error)
+		state.skip = true
+	} else if result.IsDuplicate {
+		log.Printf("Task Manager: Content of %s already backed up, skipping all its parts.", file.Path)
+		state.skip = true
+	}
+	return state
+}
+
+// writePart 将分卷写入独立的交付包（targetBase 为不含扩展名的交付包路径），返回交付包路径与分卷哈希
+// 原生归档直接从原文件的对应区间流式写入；7zr 只能读取磁盘文件，分卷需先导出到临时目录
+func (m *Manager) writePart(file *types.FileInfo, part *types.FilePart, entryName, targetBase string, enc *archiveEncryption, fileHasher *worker.HashingReader) (string, string, error) {
+	source, err := os.Open(file.Path)
+	if err != nil {
+		return "", "", fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer source.Close()
+
+	fileHasher.Continue(throttle.Reader(io.NewSectionReader(source, part.Offset, part.Size), m.readLimiter))
+	partReader := worker.NewHashingReader(fileHasher)
+
+	if !enc.use7zr {
+		targetPath := targetBase + enc.extension()
+		writer, err := packager.NewZipArchiveWriter(targetPath, m.packager.WriteLimiter(), enc.archiveRecipients())
+		if err != nil {
+			return "", "", err
+		}
+		if err := writer.AddFile(entryName, file, partReader); err != nil {
+			closeQuietly(writer)
+			return "", "", err
+		}
+		if err := writer.Close(); err != nil {
+			return "", "", err
+		}
+		if partReader.Size() != part.Size {
+			return "", "", fmt.Errorf("%w: %s", ErrFileChanged, file.Path)
+		}
+		return targetPath, partReader.Sum(), nil
+	}
+
+	stagingDir, err := os.MkdirTemp("", "beanckup_part_*")
+	if err != nil {
+		return "", "", fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	stagedPath := filepath.Join(stagingDir, filepath.FromSlash(entryName))
+	if err := exportPart(stagedPath, partReader); err != nil {
+		return "", "", err
+	}
+	if partReader.Size() != part.Size {
+		return "", "", fmt.Errorf("%w: %s", ErrFileChanged, file.Path)
+	}
+
+	targetPath := targetBase + enc.extension()
+	staged := &types.FileInfo{Path: stagedPath, Size: part.Size}
+	password := enc.keys.Password()
+	defer clear(password)
+	if err := m.packager.CreateArchiveWith7zr([]*types.FileInfo{staged}, targetPath, stagingDir, password); err != nil {
+		return "", "", err
+	}
+	return targetPath, partReader.Sum(), nil
+}
+
+// exportPart 将分卷内容写入临时文件
+func exportPart(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return fmt.Errorf("导出分卷失败: %w", err)
+	}
+	return out.Close()
+}
@@ -1,37 +1,187 @@
 package task_manager
 
 import (
+	"beanckup/backend/encryptor"
+	"beanckup/backend/file_processor"
 	"beanckup/backend/indexer"
 	"beanckup/backend/manifest_manager"
+	"beanckup/backend/packager"
+	"beanckup/backend/parity"
+	"beanckup/backend/plan_manager"
+	"beanckup/backend/resource_manager"
+	"beanckup/backend/restorer"
+	"beanckup/backend/series_manager"
+	"beanckup/backend/throttle"
 	"beanckup/backend/tree_builder"
 	"beanckup/backend/types"
+	"beanckup/backend/verifier"
+	"beanckup/backend/worker"
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"sync"
 )
 
 // Manager 任务管理器，是所有业务逻辑的编排器
 type Manager struct {
 	indexer         *indexer.Manager
 	manifestManager *manifest_manager.Manager
+	planManager     *plan_manager.Manager
+	seriesManager   *series_manager.Manager
+	resourceManager *resource_manager.Manager
+	fileProcessor   *file_processor.Manager
+	worker          *worker.Manager
+	packager        *packager.Manager
+	restorer        *restorer.Manager
+	verifier        *verifier.Manager
+	parity          *parity.Manager
+
+	// 读写限速器在各模块间共享，可在任务运行中随时调整
+	readLimiter  *throttle.Limiter
+	writeLimiter *throttle.Limiter
+
+	// 记录并在还原时恢复文件的权限、属主与扩展属性
+	preserveMetadata bool
+
+	// 打包后校验交付包，校验失败时可删除并重新打包一次
+	verifyAfterPack bool
+	repackOnFailure bool
+
+	// 为每个交付包生成的恢复数据冗余比例（百分比），0 表示不生成
+	parityRedundancy int
+
+	// 提供密码时交付包的加密方式（types.EncryptionNative 或 types.Encryption7z）
+	encryptionMode string
+
+	// 除密码外的密钥来源：密钥文件、X25519 接收者公钥与私钥
+	keySources encryptor.KeySources
+
+	mu        sync.Mutex
+	isRunning bool
+	ctx       context.Context
 }
 
 // NewManager 创建一个新的任务管理器
 func NewManager() *Manager {
 	log.Println("Task Manager initialized.")
-	return &Manager{
+	m := &Manager{
 		indexer:         indexer.NewManager(),
 		manifestManager: manifest_manager.NewManager(),
+		planManager:     plan_manager.NewManager(),
+		seriesManager:   series_manager.NewManager(),
+		resourceManager: resource_manager.NewManager(),
+		fileProcessor:   file_processor.NewManager(),
+		worker:          worker.NewManager(),
+		packager:        packager.NewManager(),
+		restorer:        restorer.NewManager(),
+		verifier:        verifier.NewManager(),
+		parity:          parity.NewManager(),
+		readLimiter:     throttle.NewLimiter(0),
+		writeLimiter:    throttle.NewLimiter(0),
+		verifyAfterPack: true,
+		encryptionMode:  types.EncryptionNative,
+	}
+	m.fileProcessor.SetReadLimiter(m.readLimiter)
+	m.worker.SetReadLimiter(m.readLimiter)
+	m.packager.SetLimiters(m.readLimiter, m.writeLimiter)
+	m.verifier.SetReadLimiter(m.readLimiter)
+	m.parity.SetLimiters(m.readLimiter, m.writeLimiter)
+	return m
+}
+
+// GetPoolStatus 获取工作池状态，包括资源管理器最近的规模调整决策
+func (m *Manager) GetPoolStatus() worker.PoolStatus {
+	return m.worker.Pool().GetStatus()
+}
+
+// SetIOLimits 设置读写限速（字节/秒，0 表示不限速），对正在运行的任务立即生效
+func (m *Manager) SetIOLimits(readBytesPerSec, writeBytesPerSec int64) {
+	m.readLimiter.SetRate(readBytesPerSec)
+	m.writeLimiter.SetRate(writeBytesPerSec)
+	log.Printf("Task Manager: I/O limits set: read %d B/s, write %d B/s (0 = unlimited).", readBytesPerSec, writeBytesPerSec)
+}
+
+// SetBackgroundMode 开启或关闭后台模式，降低工作线程（及其启动的 7zr）的 CPU 与 I/O 优先级
+// 运行中切换时，哈希工作协程立即由新的协程接替；读取、打包与校验按分集所在线程的优先级运行，
+// 正在处理的分集（包括已启动的 7zr）保持原有优先级，从下一个分集起按新设置运行
+func (m *Manager) SetBackgroundMode(enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := throttle.SetBackgroundMode(enabled); err != nil {
+		log.Printf("Task Manager: Failed to set background mode to %v: %v", enabled, err)
+		return fmt.Errorf("设置后台模式失败: %w", err)
+	}
+	log.Printf("Task Manager: Background mode set to %v.", enabled)
+	return nil
+}
+
+// RestoreFiles 根据交付路径中的清单，将文件还原到 targetPath 下
+// paths 为空时还原全部文件；分卷文件会按顺序拼接各分卷并逐卷校验
+// trustedKey 为受信任的签名公钥，清单与清单链的签名必须由它签署，为空时签名者报告为未经确认
+func (m *Manager) RestoreFiles(deliveryPath, targetPath string, paths []string, password, trustedKey string, ctx context.Context) (*types.RestoreResult, error) {
+	if err := m.beginTask(ctx); err != nil {
+		return nil, err
+	}
+	defer m.endTask()
+
+	log.Printf("Task Manager: Restoring files from %s to %s", deliveryPath, targetPath)
+	keys := m.newKeyring(password)
+	defer keys.Wipe()
+	manifest, err := m.manifestManager.LoadDeliveryManifest(deliveryPath, keys)
+	if err != nil {
+		return nil, fmt.Errorf("加载交付清单失败: %w", err)
+	}
+	integrity := m.verifyDeliveryIntegrity(deliveryPath, manifest, trustedKey)
+	if err := os.MkdirAll(targetPath, 0755); err != nil {
+		return nil, fmt.Errorf("创建还原路径失败: %w", err)
 	}
+	result := m.restorer.RestoreFiles(manifest, deliveryPath, targetPath, paths, keys)
+	result.Integrity = integrity
+	return result, nil
+}
+
+// ExportManifest 将工作区或交付路径中的清单导出为缩进的 JSON，用于调试
+// delivery 为 true 时 path 为交付路径，加密的清单用密码及已设置的密钥文件、私钥解密
+func (m *Manager) ExportManifest(path string, delivery bool, password string, w io.Writer) error {
+	var manifest *types.Manifest
+	if delivery {
+		keys := m.newKeyring(password)
+		defer keys.Wipe()
+		loaded, err := m.manifestManager.LoadDeliveryManifest(path, keys)
+		if err != nil {
+			return fmt.Errorf("加载交付清单失败: %w", err)
+		}
+		manifest = loaded
+	} else {
+		if !m.manifestManager.HasManifest(path) {
+			return fmt.Errorf("%w: %s", manifest_manager.ErrManifestNotFound, path)
+		}
+		loaded, err := m.manifestManager.LoadLatestManifest(path)
+		if err != nil {
+			return err
+		}
+		manifest = loaded
+	}
+	log.Printf("Task Manager: Exporting manifest of %s with %d files", path, len(manifest.Files))
+	return manifest_manager.ExportJSON(w, manifest)
 }
 
 // StartBackupPreparation 接收备份参数，进行预处理
-func (m *Manager) StartBackupPreparation(workspacePath string, maxPackageSizeGB, maxTotalSizeGB float64) (*types.BackupPreparationResult, error) {
+// maxTotalSizeGB 为本次任务的总量上限，超出部分按 selectionPolicy 挑选并推迟到下次运行；
+// 分集规划保存为备份计划，开始交付时按计划 ID 严格执行
+func (m *Manager) StartBackupPreparation(workspacePath string, maxPackageSizeGB, maxTotalSizeGB float64, selectionPolicy types.SelectionPolicy, priorityFolders []string) (*types.BackupPreparationResult, error) {
 	log.Printf("Task Manager: Starting backup preparation for %s", workspacePath)
+	options, err := newPlanOptions(workspacePath, maxPackageSizeGB, maxTotalSizeGB, selectionPolicy, priorityFolders)
+	if err != nil {
+		return nil, err
+	}
 
-	// 1. 扫描当前工作区的所有文件
+	// 1. 扫描当前工作区的所有文件与目录
 	// 注意：这里的进度回调暂时为nil，因为这个重量级操作的整体进度应该由task_manager在更高层面控制和报告
-	currentFiles, err := m.indexer.ScanWorkspace(workspacePath, nil)
+	currentFiles, currentDirs, err := m.indexer.ScanWorkspace(workspacePath, nil)
 	if err != nil {
 		log.Printf("Task Manager: Failed to scan workspace: %v", err)
 		return nil, fmt.Errorf("扫描工作区失败: %w", err)
@@ -40,118 +190,189 @@ func (m *Manager) StartBackupPreparation(workspacePath string, maxPackageSizeGB,
 	// 2. 加载上一次的清单
 	previousManifest, err := m.manifestManager.LoadLatestManifest(workspacePath)
 	if err != nil {
-		// 根据我们的设计，这个错误理论上不应该发生，但为了健壮性还是处理一下
+		// 清单损坏时会返回空清单，这里只会是由更新版本的程序生成、无法识别的清单
 		log.Printf("Task Manager: Failed to load previous manifest: %v", err)
 		return nil, fmt.Errorf("加载旧备份记录失败: %w", err)
 	}
 
-	// 3. 对比新旧文件，找出所有变更
+	// 3. 开启保留元数据时读取权限、属主与扩展属性，再对比新旧文件与目录，找出所有变更
+	preserveMetadata := m.metadataPreservationSetting()
+	if preserveMetadata {
+		m.indexer.CaptureMetadata(currentFiles, currentDirs)
+	}
 	changedFiles := m.indexer.QuickScan(currentFiles, previousManifest)
 	log.Printf("Task Manager: Found %d changed files.", len(changedFiles))
+	dirChanges := m.indexer.CompareDirectories(currentDirs, previousManifest)
 
-	// 4. 根据变更预估分包
-	episodes, changeInfo := m.estimateEpisodes(changedFiles, maxPackageSizeGB, maxTotalSizeGB)
-	log.Printf("Task Manager: Estimated %d episodes. Changes: %d new, %d modified, %d deleted. Total size: %d bytes.", len(episodes), changeInfo.NewCount, changeInfo.ModifiedCount, changeInfo.DeletedCount, changeInfo.TotalSize)
-
-	// 5. 根据变更构建UI文件树
-	fileTree := tree_builder.BuildTreeFromChanges(changedFiles, workspacePath)
-	log.Printf("Task Manager: Built file tree with %d root nodes.", len(fileTree))
+	// 4. 根据变更生成备份计划：按总量上限挑选本次备份的文件，并预估分包
+	plan := newBackupPlan(options, previousManifest, changedFiles)
+	plan.ChangeInfo.DirChangeCount = dirChanges
+	plan.PreserveMetadata = preserveMetadata
+	plans, err := replan(plan)
+	if err != nil {
+		return nil, err
+	}
+	changeInfo := plan.ChangeInfo
+	log.Printf("Task Manager: Estimated %d episodes. Changes: %d new, %d modified, %d deleted, %d metadata only, %d directories. Total size: %d bytes.", len(plans), changeInfo.NewCount, changeInfo.ModifiedCount, changeInfo.DeletedCount, changeInfo.MetadataCount, changeInfo.DirChangeCount, changeInfo.TotalSize)
+	if changeInfo.DeferredCount > 0 {
+		log.Printf("Task Manager: Deferred %d files (%d bytes) to the next run by policy %s.", changeInfo.DeferredCount, changeInfo.DeferredSize, options.policy)
+	}
 
-	// 6. 将所有结果打包返回
-	result := &types.BackupPreparationResult{
-		Episodes:   episodes,
-		FileTree:   fileTree,
-		ChangeInfo: changeInfo,
+	// 5. 保存备份计划
+	if err := m.planManager.SavePlan(plan); err != nil {
+		log.Printf("Task Manager: Failed to save backup plan: %v", err)
+		return nil, fmt.Errorf("保存备份计划失败: %w", err)
 	}
 
+	// 6. 根据变更构建UI文件树，并将所有结果打包返回
+	result := preparationResult(plan, plans)
+	log.Printf("Task Manager: Built file tree with %d root nodes.", len(result.FileTree))
+
 	log.Println("Task Manager: Backup preparation finished successfully.")
 	return result, nil
 }
 
-// estimateEpisodes 根据变更文件和大小限制，预估需要生成的交付包
-func (m *Manager) estimateEpisodes(changedFiles map[string]*types.FileInfo, maxPackageSizeGB, maxTotalSizeGB float64) ([]*types.Episode, struct {
-	NewCount      int   `json:"newCount"`
-	ModifiedCount int   `json:"modifiedCount"`
-	DeletedCount  int   `json:"deletedCount"`
-	TotalSize     int64 `json:"totalSize"`
-}) {
-	var filesToPack []*types.FileInfo
-	var changeInfo struct {
-		NewCount      int   `json:"newCount"`
-		ModifiedCount int   `json:"modifiedCount"`
-		DeletedCount  int   `json:"deletedCount"`
-		TotalSize     int64 `json:"totalSize"`
-	}
-
-	for _, file := range changedFiles {
-		switch file.Status {
-		case types.StatusNew:
-			changeInfo.NewCount++
-			changeInfo.TotalSize += file.Size
-			filesToPack = append(filesToPack, file)
-		case types.StatusModified:
-			changeInfo.ModifiedCount++
-			changeInfo.TotalSize += file.Size
-			filesToPack = append(filesToPack, file)
-		case types.StatusDeleted:
-			changeInfo.DeletedCount++
-		}
+// preparationResult 根据备份计划构建返回给前端的预处理结果，文件树标注排除状态与所属分集
+func preparationResult(plan *types.BackupPlan, plans []*episodePlan) *types.BackupPreparationResult {
+	changedFiles := make(map[string]*types.FileInfo, len(plan.Candidates)+len(plan.DeletedFiles)+len(plan.MetadataFiles))
+	for _, file := range plan.Candidates {
+		changedFiles[file.Path] = file
+	}
+	for _, file := range plan.MetadataFiles {
+		changedFiles[file.Path] = file
+	}
+	for _, path := range plan.DeletedFiles {
+		changedFiles[path] = &types.FileInfo{Path: path, Name: filepath.Base(path), Status: types.StatusDeleted}
 	}
 
-	if len(filesToPack) == 0 {
-		return []*types.Episode{}, changeInfo
+	options := optionsOf(plan)
+	excluded := make(map[string]bool)
+	for path := range changedFiles {
+		if options.isExcluded(path) {
+			excluded[path] = true
+		}
+	}
+	episodeOf := make(map[string]string)
+	for _, p := range plans {
+		for _, file := range p.files {
+			if _, exists := episodeOf[file.Path]; !exists {
+				episodeOf[file.Path] = p.episode.ID
+			}
+		}
 	}
 
-	maxPackageSizeBytes := int64(maxPackageSizeGB * 1024 * 1024 * 1024)
-	if maxPackageSizeBytes <= 0 {
-		maxPackageSizeBytes = 2 * 1024 * 1024 * 1024 // 默认2GB
+	fileTree := tree_builder.BuildTreeFromChanges(changedFiles, plan.WorkspacePath)
+	tree_builder.AnnotatePlan(fileTree, excluded, episodeOf)
+
+	return &types.BackupPreparationResult{
+		PlanID:        plan.ID,
+		Episodes:      episodesOf(plans),
+		FileTree:      fileTree,
+		ChangeInfo:    plan.ChangeInfo,
+		DeferredFiles: plan.DeferredFiles,
 	}
+}
 
-	var episodes []*types.Episode
-	var currentEpisodeFiles []*types.FileInfo
-	var currentEpisodeSize int64
-	episodeIndex := 1
+// planOptions 分集规划参数
+type planOptions struct {
+	workspacePath   string
+	maxPackageSize  int64 // 单个包大小上限 (字节)
+	maxTotalSize    int64 // 本次任务总量上限 (字节)，0 表示不限
+	policy          types.SelectionPolicy
+	priorityFolders []string
 
-	for _, file := range filesToPack {
-		if currentEpisodeSize+file.Size > maxPackageSizeBytes && len(currentEpisodeFiles) > 0 {
-			// 当前分集满了，创建它
-			episodes = append(episodes, createEpisode(episodeIndex, currentEpisodeFiles, currentEpisodeSize))
-			// 为下一个分集重置
-			currentEpisodeFiles = nil
-			currentEpisodeSize = 0
-			episodeIndex++
-		}
-		currentEpisodeFiles = append(currentEpisodeFiles, file)
-		currentEpisodeSize += file.Size
+	// 用户对计划的编辑
+	excluded []string
+	included []string
+	pins     map[string]string
+}
+
+// newPlanOptions 将前端传入的参数转换为规划参数，挑选策略为空时默认最早修改优先，未知的策略返回 ErrInvalidConfig
+func newPlanOptions(workspacePath string, maxPackageSizeGB, maxTotalSizeGB float64, policy types.SelectionPolicy, priorityFolders []string) (*planOptions, error) {
+	maxPackageSize := int64(maxPackageSizeGB * 1024 * 1024 * 1024)
+	if maxPackageSize <= 0 {
+		maxPackageSize = 2 * 1024 * 1024 * 1024 // 默认2GB
+	}
+	maxTotalSize := int64(maxTotalSizeGB * 1024 * 1024 * 1024)
+	if maxTotalSize < 0 {
+		maxTotalSize = 0
+	}
+	switch policy {
+	case "":
+		policy = types.PolicyOldestFirst
+	case types.PolicyOldestFirst, types.PolicySmallestFirst, types.PolicyFolderPriority:
+	default:
+		return nil, fmt.Errorf("%w: 未知的挑选策略 %q", ErrInvalidConfig, policy)
 	}
+	return &planOptions{
+		workspacePath:   workspacePath,
+		maxPackageSize:  maxPackageSize,
+		maxTotalSize:    maxTotalSize,
+		policy:          policy,
+		priorityFolders: priorityFolders,
+	}, nil
+}
 
-	// 添加最后一个（或唯一一个）分集
-	if len(currentEpisodeFiles) > 0 {
-		episodes = append(episodes, createEpisode(episodeIndex, currentEpisodeFiles, currentEpisodeSize))
+// optionsOf 从备份计划还原规划参数
+func optionsOf(plan *types.BackupPlan) *planOptions {
+	return &planOptions{
+		workspacePath:   plan.WorkspacePath,
+		maxPackageSize:  plan.MaxPackageSize,
+		maxTotalSize:    plan.MaxTotalSize,
+		policy:          plan.Policy,
+		priorityFolders: plan.PriorityFolders,
+		excluded:        plan.Excluded,
+		included:        plan.Included,
+		pins:            plan.Pins,
 	}
+}
 
-	return episodes, changeInfo
+// episodePlan 是一个分集的规划结果：分集信息及分配给它的文件
+type episodePlan struct {
+	episode *types.Episode
+	files   []*types.FileInfo
+	part    *types.FilePart // 非 nil 表示该分集承载 files[0] 的一个分卷
+}
+
+// episodesOf 从分集规划中提取分集列表
+func episodesOf(plans []*episodePlan) []*types.Episode {
+	episodes := make([]*types.Episode, 0, len(plans))
+	for _, plan := range plans {
+		episodes = append(episodes, plan.episode)
+	}
+	return episodes
+}
+
+// plannedSize 返回分集规划中所有文件的总大小
+func plannedSize(plans []*episodePlan) int64 {
+	var total int64
+	for _, plan := range plans {
+		total += plan.episode.EstimatedSize
+	}
+	return total
 }
 
 // createEpisode 是一个辅助函数，用于创建一个新的分集对象
 func createEpisode(index int, files []*types.FileInfo, size int64) *types.Episode {
 	return &types.Episode{
-		ID:            fmt.Sprintf("E%03d", index),
+		ID:            episodeID(index),
 		Name:          fmt.Sprintf("Episode-%03d", index),
-		Status:        "未交付",
+		Status:        types.EpisodePlanned,
 		FileCount:     len(files),
 		EstimatedSize: size,
 	}
 }
 
-// StartBackupExecution 启动实际的备份流程
-func (m *Manager) StartBackupExecution(workspacePath, deliveryPath string, maxPackageSizeGB, maxTotalSizeGB float64, password string, ctx context.Context) (interface{}, error) {
-	log.Printf("Task Manager: Starting backup execution for %s to %s", workspacePath, deliveryPath)
-	// TODO: 实现文件哈希、压缩、打包、生成新清单的逻辑
-	// 1. 基于预处理结果，创建并发任务
-	// 2. 使用 worker 池处理文件（哈希等）
-	// 3. 使用 packager 打包成.7z文件
-	// 4. 生成并保存最终的 manifest
-	log.Println("Task Manager: Backup execution finished (stub).")
-	return nil, nil
+// episodeID 返回分集序号对应的分集ID
+func episodeID(index int) string {
+	return fmt.Sprintf("E%03d", index)
+}
+
+// parseEpisodeID 解析分集ID中的序号
+func parseEpisodeID(id string) (int, bool) {
+	var index int
+	if _, err := fmt.Sscanf(id, "E%d", &index); err != nil || index < 1 || episodeID(index) != id {
+		return 0, false
+	}
+	return index, true
 }
@@ -0,0 +1,141 @@
+package task_manager
+
+import (
+	"beanckup/backend/packager"
+	"beanckup/backend/throttle"
+	"beanckup/backend/types"
+	"beanckup/backend/verifier"
+	"beanckup/backend/worker"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// SetDeliveryVerification 设置打包后是否校验交付包，以及校验失败时是否删除并重新打包一次
+func (m *Manager) SetDeliveryVerification(enabled, repackOnFailure bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.verifyAfterPack = enabled
+	m.repackOnFailure = repackOnFailure
+	log.Printf("Task Manager: Delivery verification set to %v (repack on failure: %v).", enabled, repackOnFailure)
+}
+
+// verificationSettings 返回当前的校验设置
+func (m *Manager) verificationSettings() (enabled, repackOnFailure bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.verifyAfterPack, m.repackOnFailure
+}
+
+// verifyEpisode 打包完成后校验分集的交付包：重新打开交付包，核对条目列表并重新计算每个条目的哈希，
+// 与即将写入清单的哈希比对；校验失败且开启了重新打包时，删除交付包并重新打包、再校验一次
+func (m *Manager) verifyEpisode(plan *episodePlan, outcome *episodeOutcome, workspacePath string, enc *archiveEncryption, progress *progressTracker) error {
+	episode := plan.episode
+	enabled, repack := m.verificationSettings()
+	if !enabled || episode.PackagePath == "" {
+		return nil
+	}
+
+	progress.report("校验中")
+	expected := expectedEntries(plan, outcome)
+	verification := m.verifier.VerifyArchive(episode.PackagePath, expected, enc.keys)
+	if len(verification.Problems) > 0 && repack {
+		log.Printf("Task Manager: Episode %s failed verification, repacking: %s", episode.Name, strings.Join(verification.Problems, "; "))
+		if err := m.repackEpisode(plan, outcome, workspacePath, enc); err != nil {
+			episode.Problems = verification.Problems
+			return fmt.Errorf("重新打包失败: %w", err)
+		}
+		verification = m.verifier.VerifyArchive(episode.PackagePath, expected, enc.keys)
+	}
+
+	episode.Problems = verification.Problems
+	if len(verification.Problems) > 0 {
+		problems := verification.Problems
+		more := ""
+		if len(problems) > maxReportedPaths {
+			more = fmt.Sprintf(" 等 %d 个问题", len(problems))
+			problems = problems[:maxReportedPaths]
+		}
+		return fmt.Errorf("%w: %s%s", ErrVerificationFailed, strings.Join(problems, "; "), more)
+	}
+
+	now := time.Now()
+	episode.VerifiedAt = &now
+	episode.Status = types.EpisodeVerified
+	m.emitEpisodeStatus(episode)
+	log.Printf("Task Manager: Episode %s verified: %d entries.", episode.Name, verification.CheckedCount)
+	return nil
+}
+
+// expectedEntries 返回分集交付包中应有的条目：分卷分集只有一个分卷条目，其余分集为写入交付包的文件
+func expectedEntries(plan *episodePlan, outcome *episodeOutcome) []verifier.Entry {
+	if plan.part != nil {
+		return []verifier.Entry{{Name: plan.part.EntryName, Size: plan.part.Size, Hash: plan.part.Hash}}
+	}
+	entries := make([]verifier.Entry, 0, len(outcome.packed))
+	for _, file := range outcome.packed {
+		entries = append(entries, verifier.Entry{Name: file.EntryName, Size: file.Size, Hash: file.ContentHash})
+	}
+	return entries
+}
+
+// repackEpisode 删除校验失败的交付包，从工作区重新读取文件写入同名交付包
+// 重新读取的内容必须与清单中记录的哈希一致，否则说明文件已被修改
+func (m *Manager) repackEpisode(plan *episodePlan, outcome *episodeOutcome, workspacePath string, enc *archiveEncryption) error {
+	episode := plan.episode
+	if err := os.Remove(episode.PackagePath); err != nil {
+		return fmt.Errorf("删除交付包失败: %w", err)
+	}
+
+	if plan.part != nil {
+		part := plan.part
+		targetBase := strings.TrimSuffix(episode.PackagePath, enc.extension())
+		_, partHash, err := m.writePart(plan.files[0], part, part.EntryName, targetBase, enc, worker.NewHashingReader(nil))
+		if err != nil {
+			return err
+		}
+		if partHash != part.Hash {
+			return fmt.Errorf("%w: %s", ErrFileChanged, plan.files[0].Path)
+		}
+		return nil
+	}
+
+	if enc.use7zr {
+		// 7zr 自行读取文件，重新打包后的内容由随后的校验比对
+		password := enc.keys.Password()
+		defer clear(password)
+		return m.packager.CreateArchiveWith7zr(outcome.packed, episode.PackagePath, workspacePath, password)
+	}
+
+	writer, err := packager.NewZipArchiveWriter(episode.PackagePath, m.packager.WriteLimiter(), enc.archiveRecipients())
+	if err != nil {
+		return err
+	}
+	for _, file := range outcome.packed {
+		if err := m.repackFile(writer, file); err != nil {
+			closeQuietly(writer)
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// repackFile 从工作区重新读取一个文件写入交付包，并确认内容与已记录的哈希一致
+func (m *Manager) repackFile(writer packager.ArchiveWriter, file *types.FileInfo) error {
+	source, err := os.Open(file.Path)
+	if err != nil {
+		return fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer source.Close()
+
+	hasher := worker.NewHashingReader(throttle.Reader(source, m.readLimiter))
+	if err := writer.AddFile(file.EntryName, file, hasher); err != nil {
+		return err
+	}
+	if hasher.Size() != file.Size || hasher.Sum() != file.ContentHash {
+		return fmt.Errorf("%w: %s", ErrFileChanged, file.Path)
+	}
+	return nil
+}
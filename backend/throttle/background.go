@@ -0,0 +1,67 @@
+package throttle
+
+import (
+	"log"
+	"runtime"
+	"sync"
+)
+
+// 后台模式只作用于专用的工作线程：开启时，工作协程锁定到独占的 OS 线程并降低该线程的 CPU 与 I/O 优先级；
+// 关闭时不恢复（恢复优先级需要 CAP_SYS_NICE 或足够的 RLIMIT_NICE），而是让这些协程退出，
+// 被锁定的线程随协程一同销毁，之后的工作在新的协程上以正常优先级进行。其余线程（界面、运行时）的优先级保持不变。
+var background = struct {
+	mu      sync.Mutex
+	enabled bool
+	changed chan struct{} // 模式切换时关闭并替换，通知工作协程交接
+}{changed: make(chan struct{})}
+
+// setBackground 记录后台模式，模式变化时通知所有工作线程
+func setBackground(enabled bool) {
+	background.mu.Lock()
+	defer background.mu.Unlock()
+	if background.enabled == enabled {
+		return
+	}
+	background.enabled = enabled
+	close(background.changed)
+	background.changed = make(chan struct{})
+}
+
+// Thread 工作协程所在的线程
+type Thread struct {
+	changed <-chan struct{}
+}
+
+// EnterThread 由工作协程在开始时调用：后台模式开启时将协程锁定到当前线程并降低其优先级
+// 锁定的协程结束时不解锁，线程随之退出（主线程则被运行时永久挂起，不再执行任何代码），
+// 因此调用方必须在 Changed 通知后尽快结束协程，由新的协程接替
+func EnterThread() *Thread {
+	background.mu.Lock()
+	enabled, changed := background.enabled, background.changed
+	background.mu.Unlock()
+
+	if enabled {
+		// 先锁定再降低优先级：锁定后运行时改由模板线程创建新线程，新线程不会继承降低后的优先级
+		runtime.LockOSThread()
+		if err := lowerThreadPriority(); err != nil {
+			log.Printf("Throttle: Failed to lower worker thread priority: %v", err)
+		}
+	}
+	return &Thread{changed: changed}
+}
+
+// Changed 返回在后台模式切换时关闭的通道
+func (t *Thread) Changed() <-chan struct{} {
+	return t.changed
+}
+
+// Run 在新的工作线程上执行 fn 并等待其完成，fn 按执行开始时的后台模式运行（包括其间启动的子进程）
+func Run(fn func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		EnterThread()
+		fn()
+	}()
+	<-done
+}
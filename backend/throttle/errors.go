@@ -0,0 +1,8 @@
+package throttle
+
+import "errors"
+
+var (
+	// ErrBackgroundModeUnsupported 当前平台不支持后台模式
+	ErrBackgroundModeUnsupported = errors.New("当前平台不支持后台模式")
+)
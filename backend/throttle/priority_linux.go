@@ -0,0 +1,38 @@
+//go:build linux
+
+package throttle
+
+import (
+	"fmt"
+	"syscall"
+)
+
+const (
+	ioprioClassBE    = 2  // 尽力而为调度类，对应 ionice -c2
+	ioprioClassShift = 13 // 调度类在优先级值中的偏移
+	ioprioWhoProcess = 1  // 按线程/进程 ID 设置
+
+	backgroundNice    = 10 // 后台模式的 CPU 优先级，对应 nice -n 10
+	backgroundIOLevel = 7  // 后台模式的 I/O 优先级，对应 ionice -c2 -n7
+)
+
+// SetBackgroundMode 开启或关闭后台模式：开启后新的工作线程以 nice 10、ionice -c2 -n7 运行；
+// 关闭后已降低优先级的工作线程在手头工作结束后退出（见 background.go），无需任何特权
+func SetBackgroundMode(enabled bool) error {
+	setBackground(enabled)
+	return nil
+}
+
+// lowerThreadPriority 降低当前线程的 CPU 与 I/O 优先级，之后由该线程启动的子进程（如 7zr）继承这一优先级
+// Linux 上 nice 与 ioprio 都是按线程生效的，降低优先级不需要特权
+func lowerThreadPriority() error {
+	tid := syscall.Gettid()
+	if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, backgroundNice); err != nil {
+		return fmt.Errorf("设置CPU优先级失败: %w", err)
+	}
+	ioprio := ioprioClassBE<<ioprioClassShift | backgroundIOLevel
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(ioprio)); errno != 0 {
+		return fmt.Errorf("设置I/O优先级失败: %w", errno)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package throttle
+
+// SetBackgroundMode 当前平台尚未实现后台模式
+func SetBackgroundMode(enabled bool) error {
+	return ErrBackgroundModeUnsupported
+}
+
+// lowerThreadPriority 当前平台尚未实现，后台模式无法开启，不会被调用
+func lowerThreadPriority() error {
+	return ErrBackgroundModeUnsupported
+}
@@ -0,0 +1,156 @@
+package throttle
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// chunkSize 单次读写的最大字节数，限速时按块等待，避免一次大块读写造成长时间突发
+	chunkSize = 64 * 1024
+
+	// maxSleep 单次等待的上限，使运行中调整的速率能及时生效
+	maxSleep = 100 * time.Millisecond
+)
+
+// Limiter 令牌桶限速器，速率以字节/秒计，可在运行中随时调整
+// nil 或速率为 0 的限速器不做任何限制
+type Limiter struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter 创建一个限速器，bytesPerSec 为 0 表示不限速
+func NewLimiter(bytesPerSec int64) *Limiter {
+	return &Limiter{
+		rate: bytesPerSec,
+		last: time.Now(),
+	}
+}
+
+// SetRate 调整速率，bytesPerSec 为 0 表示不限速
+func (l *Limiter) SetRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	l.rate = bytesPerSec
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// Rate 返回当前速率
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// WaitN 阻塞直到可以处理 n 个字节
+func (l *Limiter) WaitN(n int) {
+	if l == nil {
+		return
+	}
+
+	for n > 0 {
+		l.mu.Lock()
+		if l.rate <= 0 {
+			l.mu.Unlock()
+			return
+		}
+
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		l.last = now
+		// 令牌最多积累一秒的量，限制突发
+		if burst := float64(l.rate); l.tokens > burst {
+			l.tokens = burst
+		}
+
+		// 每次最多申请一块，且不超过令牌上限，否则低速率下永远攒不够令牌
+		need := n
+		if need > chunkSize {
+			need = chunkSize
+		}
+		if int64(need) > l.rate {
+			need = int(l.rate)
+		}
+		if l.tokens >= float64(need) {
+			l.tokens -= float64(need)
+			n -= need
+			l.mu.Unlock()
+			continue
+		}
+
+		wait := time.Duration((float64(need) - l.tokens) / float64(l.rate) * float64(time.Second))
+		l.mu.Unlock()
+		if wait > maxSleep {
+			wait = maxSleep
+		}
+		time.Sleep(wait)
+	}
+}
+
+// limitedReader 限速读取流
+type limitedReader struct {
+	reader  io.Reader
+	limiter *Limiter
+}
+
+// Reader 返回按 limiter 限速的读取流，limiter 为 nil 时直接返回原读取流
+func Reader(r io.Reader, limiter *Limiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &limitedReader{reader: r, limiter: limiter}
+}
+
+// Read 实现 io.Reader
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > chunkSize {
+		p = p[:chunkSize]
+	}
+	n, err := r.reader.Read(p)
+	r.limiter.WaitN(n)
+	return n, err
+}
+
+// limitedWriter 限速写入流
+type limitedWriter struct {
+	writer  io.Writer
+	limiter *Limiter
+}
+
+// Writer 返回按 limiter 限速的写入流，limiter 为 nil 时直接返回原写入流
+func Writer(w io.Writer, limiter *Limiter) io.Writer {
+	if limiter == nil {
+		return w
+	}
+	return &limitedWriter{writer: w, limiter: limiter}
+}
+
+// Write 实现 io.Writer
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		w.limiter.WaitN(len(chunk))
+		n, err := w.writer.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -83,3 +83,29 @@ func sortNodes(nodes []*types.TreeNode) {
 		return strings.ToLower(nodes[i].Name) < strings.ToLower(nodes[j].Name)
 	})
 }
+
+// AnnotatePlan 在文件树上标注备份计划信息：文件是否被排除、被分配到哪个分集
+// 目录下的所有变更文件都被排除时，目录本身也标记为排除
+func AnnotatePlan(nodes []*types.TreeNode, excluded map[string]bool, episodeOf map[string]string) {
+	for _, node := range nodes {
+		annotateNode(node, excluded, episodeOf)
+	}
+}
+
+// annotateNode 递归标注单个节点，返回该节点是否被排除
+func annotateNode(node *types.TreeNode, excluded map[string]bool, episodeOf map[string]string) bool {
+	if !node.IsDir {
+		node.Excluded = excluded[node.Path]
+		node.EpisodeID = episodeOf[node.Path]
+		return node.Excluded
+	}
+
+	allExcluded := len(node.Children) > 0
+	for _, child := range node.Children {
+		if !annotateNode(child, excluded, episodeOf) {
+			allExcluded = false
+		}
+	}
+	node.Excluded = allExcluded
+	return allExcluded
+}
@@ -9,12 +9,35 @@ const DebugMode = false
 
 // FileInfo 文件信息
 type FileInfo struct {
-	Path        string     `json:"path"`
-	Name        string     `json:"name"`
-	Size        int64      `json:"size"`
-	ModTime     time.Time  `json:"modTime"`
-	ContentHash string     `json:"contentHash"`
-	Status      FileStatus `json:"status"`
+	Path        string      `json:"path"`
+	Name        string      `json:"name"`
+	Size        int64       `json:"size"`
+	ModTime     time.Time   `json:"modTime"`
+	ContentHash string      `json:"contentHash"`
+	Status      FileStatus  `json:"status"`
+	EpisodeID   string      `json:"episodeId,omitempty"` // 文件内容所在交付包的ID
+	EntryName   string      `json:"entryName,omitempty"` // 文件内容在交付包内的条目名（分卷文件为还原后的条目名）
+	Parts       []*FilePart `json:"parts,omitempty"`     // 超过包大小上限的文件按顺序拆分到多个分集的分卷
+	Posix       *PosixMeta  `json:"posix,omitempty"`     // 权限、属主与扩展属性，开启保留元数据时记录
+}
+
+// PosixMeta POSIX 文件元数据
+// ACL 以扩展属性 system.posix_acl_access / system.posix_acl_default 的形式保存在 Xattrs 中
+type PosixMeta struct {
+	Mode   uint32            `json:"mode"`             // 权限位，含 setuid、setgid 与 sticky 位
+	UID    int               `json:"uid"`              // 属主
+	GID    int               `json:"gid"`              // 属组
+	Xattrs map[string][]byte `json:"xattrs,omitempty"` // 扩展属性，值以 base64 编码保存
+}
+
+// FilePart 超大文件的一个分卷，依次拼接各分卷即可还原整个文件
+type FilePart struct {
+	Index     int    `json:"index"`     // 分卷序号，从 1 开始
+	EpisodeID string `json:"episodeId"` // 分卷所在交付包的ID
+	EntryName string `json:"entryName"` // 分卷在交付包内的条目名
+	Offset    int64  `json:"offset"`    // 分卷在原文件中的起始偏移
+	Size      int64  `json:"size"`
+	Hash      string `json:"hash"` // 分卷内容的哈希，用于还原时逐卷校验
 }
 
 // FileStatus 文件状态
@@ -26,6 +49,7 @@ const (
 	StatusModified  FileStatus = "modified"
 	StatusMoved     FileStatus = "moved"
 	StatusDeleted   FileStatus = "deleted"
+	StatusMetadata  FileStatus = "metadata" // 内容未变，只有权限、属主或扩展属性变化
 )
 
 // TaskType 任务类型
@@ -69,18 +93,81 @@ type TaskUnit struct {
 
 // Episode 备份集
 type Episode struct {
-	ID            string    `json:"id"`
-	Name          string    `json:"name"`
-	SeriesID      string    `json:"seriesId"`
-	CreatedAt     time.Time `json:"createdAt"`
-	Status        string    `json:"status"`
-	PackagePath   string    `json:"packagePath"`
-	FileCount     int       `json:"fileCount"`
-	TotalSize     int64     `json:"totalSize"`
-	EstimatedSize int64     `json:"estimatedSize"`
-}
-
-// Series 备份系列
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	SeriesID      string     `json:"seriesId"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	Status        string     `json:"status"`
+	PackagePath   string     `json:"packagePath"`
+	FileCount     int        `json:"fileCount"`
+	TotalSize     int64      `json:"totalSize"`
+	EstimatedSize int64      `json:"estimatedSize"`
+	SplitFile     string     `json:"splitFile,omitempty"`   // 分卷分集所属的超大文件路径
+	PartIndex     int        `json:"partIndex,omitempty"`   // 分卷序号，从 1 开始
+	PartCount     int        `json:"partCount,omitempty"`   // 该文件的分卷总数
+	PlanID        string     `json:"planId,omitempty"`      // 生成该分集的备份计划
+	DeliveredAt   *time.Time `json:"deliveredAt,omitempty"` // 清单保存、分集正式交付的时间，尚未交付时为空
+	Checksum      string     `json:"checksum,omitempty"`    // 交付包文件的 SHA-256
+	VerifiedAt    *time.Time `json:"verifiedAt,omitempty"`  // 最近一次校验通过的时间，尚未校验时为空
+	Problems      []string   `json:"problems,omitempty"`    // 最近一次校验发现的问题
+	ParityFile    string     `json:"parityFile,omitempty"`  // 恢复数据文件名（与交付包位于同一目录）
+	Redundancy    int        `json:"redundancy,omitempty"`  // 恢复数据的冗余比例（百分比）
+
+	Encryption *EncryptionInfo `json:"encryption,omitempty"` // 交付包的加密方式，未加密时为空
+}
+
+// 交付包与清单的加密方式
+const (
+	EncryptionNative = "native" // 原生加密层（XChaCha20-Poly1305，密钥由 Argon2id 从密码派生），适用于任意归档格式
+	Encryption7z     = "7z"     // 交给 7zr 以 AES-256 加密打包
+)
+
+// KDFParams 由密码派生密钥加密密钥（KEK）的参数
+type KDFParams struct {
+	Algorithm string `json:"algorithm"` // 目前为 argon2id
+	Salt      []byte `json:"salt"`
+	Time      uint32 `json:"time"`
+	Memory    uint32 `json:"memory"` // KiB
+	Threads   uint8  `json:"threads"`
+}
+
+// EncryptionInfo 交付包或清单的加密信息，不包含任何密钥材料
+type EncryptionInfo struct {
+	Mode       string          `json:"mode"`                 // native 或 7z
+	Algorithm  string          `json:"algorithm"`            // 数据加密算法
+	ChunkSize  int             `json:"chunkSize,omitempty"`  // 原生加密层的分块大小
+	Recipients []RecipientInfo `json:"recipients,omitempty"` // 原生加密层中能解开数据加密密钥的接收者
+}
+
+// RecipientInfo 原生加密层的一个接收者（密码、密钥文件或 X25519 公钥），不包含任何密钥材料
+type RecipientInfo struct {
+	Type      string     `json:"type"`                // password、keyfile 或 x25519
+	KeyID     string     `json:"keyId"`               // 密钥标识，用于区分不同的密码、密钥文件或公钥
+	KDF       *KDFParams `json:"kdf,omitempty"`       // 密码接收者派生 KEK 的参数
+	PublicKey string     `json:"publicKey,omitempty"` // X25519 接收者的公钥
+}
+
+// KeyRotationReport 密钥轮换的结果
+type KeyRotationReport struct {
+	DeliveryPath string          `json:"deliveryPath"`
+	RotatedCount int             `json:"rotatedCount"` // 重新封装了数据加密密钥的交付包数
+	Skipped      []string        `json:"skipped"`      // 未经原生加密层加密或已用新密钥加密、无需轮换的交付包
+	Failed       []string        `json:"failed"`       // 轮换失败的交付包及原因
+	Encryption   *EncryptionInfo `json:"encryption"`   // 轮换后的加密信息
+}
+
+// 分集的生命周期状态：未交付 → 打包中 → 已交付 → 已校验 → 已归档/已清理，打包或校验失败时为失败
+const (
+	EpisodePlanned   = "未交付"
+	EpisodePacking   = "打包中"
+	EpisodeDelivered = "已交付"
+	EpisodeVerified  = "已校验"
+	EpisodeArchived  = "已归档"
+	EpisodePruned    = "已清理"
+	EpisodeFailed    = "失败"
+)
+
+// Series 备份系列，记录一个工作区历次运行产生的所有分集，保存在工作区的 .beanckup/series.json
 type Series struct {
 	ID        string     `json:"id"`
 	Name      string     `json:"name"`
@@ -89,6 +176,17 @@ type Series struct {
 	Episodes  []*Episode `json:"episodes"`
 	FileCount int        `json:"fileCount"`
 	TotalSize int64      `json:"totalSize"`
+	Sequence  int        `json:"sequence"` // 最近分配的分集序号，跨运行单调递增
+
+	NamingTemplate string `json:"namingTemplate,omitempty"` // 交付包命名模板，为空时使用默认模板
+
+	PasswordVerifier *PasswordVerifier `json:"passwordVerifier,omitempty"` // 系列使用的密码的校验值，未设置密码时为空
+}
+
+// PasswordVerifier 由密码派生的校验值，用于在打包前确认密码与系列之前的运行一致；不能由它反推出密码或加密密钥
+type PasswordVerifier struct {
+	KDF   KDFParams `json:"kdf"`   // 独立的随机盐，与交付包使用的派生参数无关
+	Check string    `json:"check"` // 以派生密钥计算的 HMAC-SHA256
 }
 
 // BackupConfig 备份配置
@@ -121,26 +219,100 @@ type ResourceInfo struct {
 	Threshold       int64   `json:"threshold"`
 }
 
-// Manifest 清单文件结构
+// ScalingDecision 资源管理器对工作池规模的一次调整决策
+type ScalingDecision struct {
+	Time            time.Time `json:"time"`
+	From            int       `json:"from"`
+	To              int       `json:"to"`
+	Reason          string    `json:"reason"`
+	CPUPercent      float64   `json:"cpuPercent"`
+	MemoryAvailable float64   `json:"memoryAvailable"` // 可用内存百分比
+	DiskThroughput  float64   `json:"diskThroughput"`  // 磁盘吞吐 (字节/秒)
+}
+
+// ManifestVersion 当前的清单结构版本；较早版本的清单读取时由 manifest_manager 迁移到当前版本
+// 1.0：缩进的 JSON，文件与目录以绝对路径为键，同时带有 directories 与 dirs 两个目录映射，以及未定义结构的 metadata
+// 3.0：目录只记录在 dirs 中，去掉 metadata；文件与目录的路径相对于工作区根目录、以 / 分隔，并记录工作区标识（2.0 未曾发布）
+const ManifestVersion = "3.0"
+
+// Manifest 清单文件结构（结构版本 3.0）
+// 保存的清单中文件与目录的键及路径相对于工作区根目录、以 / 分隔；读取后由 manifest_manager 按工作区当前位置
+// （交付路径中的清单按记录的工作区路径）展开为绝对路径，因此内存中的清单仍以绝对路径为键
 type Manifest struct {
-	Version     string                 `json:"version"`
-	CreatedAt   time.Time              `json:"createdAt"`
-	SeriesID    string                 `json:"seriesId"`
-	EpisodeID   string                 `json:"episodeId"`
-	Files       map[string]*FileInfo   `json:"files"`
-	Directories map[string]*DirInfo    `json:"directories"`
-	Metadata    map[string]interface{} `json:"metadata"`
-	HashToFile  map[string]string      `json:"hashToFile"` // 哈希值到文件路径的映射，用于去重
-	Dirs        map[string]*DirInfo    `json:"dirs"`       // key 是目录绝对路径
+	Version       string               `json:"version"`
+	CreatedAt     time.Time            `json:"createdAt"`
+	SeriesID      string               `json:"seriesId"`
+	EpisodeID     string               `json:"episodeId"`
+	WorkspaceID   string               `json:"workspaceId,omitempty"`   // 工作区标识，记录在 .beanckup/workspace.json 中，工作区移动后不变
+	WorkspacePath string               `json:"workspacePath,omitempty"` // 生成清单时的工作区路径，还原时用于计算文件的相对路径
+	Files         map[string]*FileInfo `json:"files"`
+	HashToFile    map[string]string    `json:"hashToFile"`         // 哈希值到文件路径的映射，用于去重
+	Packages      map[string]string    `json:"packages,omitempty"` // 分集ID到交付包文件名（相对于交付路径）的映射，用于还原
+	Dirs          map[string]*DirInfo  `json:"dirs"`               // key 是目录路径
+
+	PrevHash  string     `json:"prevHash,omitempty"`  // 上一份清单的哈希，第一份签名的清单为空
+	Signature *Signature `json:"signature,omitempty"` // 工作区签名密钥对清单（不含签名本身）的签名
+
+	// SourceHash 读取时按保存的原始内容（相对路径，较早结构版本为迁移前的内容）计算的清单哈希；
+	// 签名针对保存的内容，校验读取到的清单时使用该值
+	SourceHash string `json:"-"`
+}
+
+// WorkspaceIdentity 工作区标识，保存在 .beanckup/workspace.json，随 .beanckup 目录一起移动
+type WorkspaceIdentity struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Signature Ed25519 签名
+type Signature struct {
+	Algorithm string `json:"algorithm"` // 目前为 ed25519
+	PublicKey string `json:"publicKey"` // 签名公钥（base64）
+	Value     string `json:"value"`     // 签名（base64）
+}
+
+// ManifestChain 清单链：每次运行追加一项，记录清单的哈希与上一份清单的哈希，随系列登记保存在工作区与交付路径
+type ManifestChain struct {
+	Entries []*ChainEntry `json:"entries"`
+}
+
+// ChainEntry 清单链中的一项，签名覆盖除签名本身以外的全部字段
+type ChainEntry struct {
+	Sequence     int             `json:"sequence"`     // 从 1 开始连续递增
+	ManifestHash string          `json:"manifestHash"` // 本次运行生成的清单（不含签名）的 SHA-256
+	PrevHash     string          `json:"prevHash"`     // 上一项的清单哈希，第一项为空
+	CreatedAt    time.Time       `json:"createdAt"`
+	Episodes     []*ChainEpisode `json:"episodes"`              // 本次运行交付的分集
+	KeyRotation  bool            `json:"keyRotation,omitempty"` // 密钥轮换项：不对应新的清单（清单哈希与上一项相同），只重新登记轮换后的交付包
+	Signature    *Signature      `json:"signature"`
+}
+
+// ChainEpisode 清单链中记录的分集元数据；交付包的校验和在密钥轮换后由新的清单链项重新登记
+type ChainEpisode struct {
+	ID          string `json:"id"`
+	PackageName string `json:"packageName"` // 交付包文件名（相对于交付路径）
+	FileCount   int    `json:"fileCount"`
+	TotalSize   int64  `json:"totalSize"`
+	Checksum    string `json:"checksum,omitempty"` // 交付包文件的 SHA-256，签名功能启用前交付、没有记录校验和的分集为空
+}
+
+// IntegrityReport 清单签名与清单链的校验结果
+type IntegrityReport struct {
+	Signed      bool     `json:"signed"`      // 清单带有签名
+	PublicKey   string   `json:"publicKey"`   // 签名公钥，可与工作区的签名公钥比对
+	Trusted     bool     `json:"trusted"`     // 全部签名都由调用方提供的受信任公钥签署；未提供受信任公钥时为 false
+	ChainLength int      `json:"chainLength"` // 清单链的项数
+	Problems    []string `json:"problems"`    // 发现的问题：签名无效、链断裂、未登记的分集等，为空表示完整
 }
 
 // DirInfo 目录信息
 type DirInfo struct {
-	Path      string    `json:"path"`
-	Name      string    `json:"name"`
-	ModTime   time.Time `json:"modTime"`
-	FileCount int       `json:"fileCount"`
-	TotalSize int64     `json:"totalSize"`
+	Path      string     `json:"path"`
+	Name      string     `json:"name"`
+	ModTime   time.Time  `json:"modTime"`
+	FileCount int        `json:"fileCount"`       // 目录（含各级子目录）中记录在清单里的文件数
+	TotalSize int64      `json:"totalSize"`       // 这些文件的总大小
+	Posix     *PosixMeta `json:"posix,omitempty"` // 权限、属主与扩展属性，开启保留元数据时记录
 }
 
 // SessionState 会话状态（用于断点续传）
@@ -160,16 +332,135 @@ type TreeNode struct {
 	IsDir    bool        `json:"isDir"`
 	Status   FileStatus  `json:"status,omitempty"`
 	Children []*TreeNode `json:"children,omitempty"`
+
+	Excluded  bool   `json:"excluded,omitempty"`  // 用户已将其排除在本次备份之外（目录表示其下所有变更均被排除）
+	EpisodeID string `json:"episodeId,omitempty"` // 文件被分配到的分集，推迟或排除的文件为空
+}
+
+// SpaceCheck 交付路径剩余空间预检结果
+type SpaceCheck struct {
+	DeliveryPath  string `json:"deliveryPath"`
+	FreeBytes     int64  `json:"freeBytes"`     // 交付路径所在卷的可用空间
+	RequiredBytes int64  `json:"requiredBytes"` // 预估的交付包总大小加清单开销
+	Sufficient    bool   `json:"sufficient"`    // 可用空间是否足够
+	Warning       string `json:"warning,omitempty"`
+}
+
+// BackupExecutionResult 是 "开始交付" (StartBackupExecution) 完成后返回给前端的聚合数据
+type BackupExecutionResult struct {
+	Episodes      []*Episode  `json:"episodes"`
+	Threshold     int64       `json:"threshold"`               // 本次运行采用的内存处理阈值 (字节)
+	PackedCount   int         `json:"packedCount"`             // 实际写入交付包的文件数
+	DedupCount    int         `json:"dedupCount"`              // 因内容重复仅更新元数据的文件数
+	DeletedCount  int         `json:"deletedCount"`            // 从清单中移除的文件数
+	MetadataCount int         `json:"metadataCount"`           // 只更新了权限、属主或扩展属性的文件数
+	DeferredCount int         `json:"deferredCount"`           // 超出总量上限、推迟到下次运行的文件数
+	DeferredSize  int64       `json:"deferredSize"`            // 推迟文件的总大小
+	TotalSize     int64       `json:"totalSize"`               // 实际写入交付包的数据量 (字节)
+	SpaceCheck    *SpaceCheck `json:"spaceCheck"`              // 执行前的空间预检结果
+	RegistryError string      `json:"registryError,omitempty"` // 清单已保存但系列登记更新失败的原因
+}
+
+// SelectionPolicy 变更总量超过本次任务上限时，挑选本次备份文件的优先级策略
+type SelectionPolicy string
+
+const (
+	PolicyOldestFirst    SelectionPolicy = "oldest-first"    // 最早变更的文件优先
+	PolicySmallestFirst  SelectionPolicy = "smallest-first"  // 最小的文件优先
+	PolicyFolderPriority SelectionPolicy = "folder-priority" // 按用户指定的文件夹顺序优先
+)
+
+// ChangeInfo 变更统计
+type ChangeInfo struct {
+	NewCount       int   `json:"newCount"`
+	ModifiedCount  int   `json:"modifiedCount"`
+	DeletedCount   int   `json:"deletedCount"`
+	TotalSize      int64 `json:"totalSize"`      // 所有新增与修改文件的总大小
+	DeferredCount  int   `json:"deferredCount"`  // 超出本次任务总量上限、推迟到下次运行的文件数
+	DeferredSize   int64 `json:"deferredSize"`   // 推迟文件的总大小
+	ExcludedCount  int   `json:"excludedCount"`  // 用户排除在本次备份之外的新增与修改文件数（被排除的删除与元数据变化不计入，留待下次运行）
+	ExcludedSize   int64 `json:"excludedSize"`   // 排除文件的总大小
+	DirChangeCount int   `json:"dirChangeCount"` // 新增、删除或修改时间变化的目录数，只有目录变化时交付也会保存新清单
+	MetadataCount  int   `json:"metadataCount"`  // 内容未变、只有权限、属主或扩展属性变化的文件数，只更新清单记录
 }
 
 // BackupPreparationResult 是 "首次扫描" (StartBackupPreparation) 成功后返回给前端的聚合数据
 type BackupPreparationResult struct {
-	Episodes   []*Episode  `json:"episodes"`
-	FileTree   []*TreeNode `json:"fileTree"`
-	ChangeInfo struct {
-		NewCount      int   `json:"newCount"`
-		ModifiedCount int   `json:"modifiedCount"`
-		DeletedCount  int   `json:"deletedCount"`
-		TotalSize     int64 `json:"totalSize"`
-	} `json:"changeInfo"`
+	PlanID        string      `json:"planId"` // 持久化的备份计划 ID，开始交付时按此计划执行
+	Episodes      []*Episode  `json:"episodes"`
+	FileTree      []*TreeNode `json:"fileTree"`
+	ChangeInfo    ChangeInfo  `json:"changeInfo"`
+	DeferredFiles []string    `json:"deferredFiles"` // 推迟到下次运行的文件路径
+}
+
+// BackupPlan 预处理生成的备份计划，保存在工作区的 .beanckup/plans 中，开始交付时严格按计划执行
+type BackupPlan struct {
+	ID               string            `json:"id"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	WorkspacePath    string            `json:"workspacePath"`
+	BaseManifest     string            `json:"baseManifest"` // 计划所基于的清单标识，清单变化后计划失效
+	MaxPackageSize   int64             `json:"maxPackageSize"`
+	MaxTotalSize     int64             `json:"maxTotalSize"`
+	Policy           SelectionPolicy   `json:"policy"`
+	PriorityFolders  []string          `json:"priorityFolders,omitempty"`
+	Candidates       []*FileInfo       `json:"candidates"`         // 预处理发现的所有新增与修改文件，编辑计划时据此重新规划
+	Excluded         []string          `json:"excluded,omitempty"` // 用户排除的文件或目录
+	Included         []string          `json:"included,omitempty"` // 在已排除目录中重新纳入的文件或目录，最具体的规则生效
+	Pins             map[string]string `json:"pins,omitempty"`     // 文件或目录固定分配到的分集ID，最具体的规则生效
+	Episodes         []*PlannedEpisode `json:"episodes"`
+	DeletedFiles     []string          `json:"deletedFiles"`               // 将从清单中移除的文件
+	DeferredFiles    []string          `json:"deferredFiles"`              // 推迟到下次运行的文件
+	MetadataFiles    []*FileInfo       `json:"metadataFiles,omitempty"`    // 只有元数据变化的文件，执行时只更新清单记录，不重新打包
+	PreserveMetadata bool              `json:"preserveMetadata,omitempty"` // 是否记录权限、属主与扩展属性，执行时按此重新扫描
+	ChangeInfo       ChangeInfo        `json:"changeInfo"`
+}
+
+// PlannedEpisode 计划中的一个分集及分配给它的文件
+type PlannedEpisode struct {
+	Episode *Episode    `json:"episode"`
+	Files   []*FileInfo `json:"files"`          // 预处理时的文件元数据（已知时包含哈希），执行前据此校验工作区
+	Part    *FilePart   `json:"part,omitempty"` // 非空表示该分集承载超大文件的一个分卷
+}
+
+// ArchiveVerification 一个交付包的校验结果
+type ArchiveVerification struct {
+	PackagePath  string   `json:"packagePath"`
+	EntryCount   int      `json:"entryCount"`   // 交付包中的文件条目数
+	CheckedCount int      `json:"checkedCount"` // 重新计算哈希并比对通过的条目数
+	Problems     []string `json:"problems"`     // 缺失、多余或内容不符的条目，以及无法读取的原因
+}
+
+// ScrubReport 交付路径定期校验（scrub）的报告
+type ScrubReport struct {
+	DeliveryPath string                 `json:"deliveryPath"`
+	Deep         bool                   `json:"deep"` // 深度校验：解压并重新计算全部条目的哈希；否则只比对交付包文件的校验和
+	StartedAt    time.Time              `json:"startedAt"`
+	FinishedAt   time.Time              `json:"finishedAt"`
+	CheckedCount int                    `json:"checkedCount"` // 校验通过的交付包数
+	Missing      []string               `json:"missing"`      // 清单引用但交付路径中不存在的交付包
+	Corrupt      []*ArchiveVerification `json:"corrupt"`      // 校验失败的交付包及发现的问题
+	Orphaned     []string               `json:"orphaned"`     // 交付路径中未被清单引用的交付包
+	Integrity    *IntegrityReport       `json:"integrity"`    // 清单签名与清单链的校验结果
+}
+
+// ParityReport 按恢复数据校验或修复一个交付包的结果
+type ParityReport struct {
+	PackagePath   string   `json:"packagePath"`
+	ParityPath    string   `json:"parityPath"`
+	BlockCount    int      `json:"blockCount"`    // 交付包的数据块数
+	DamagedBlocks int      `json:"damagedBlocks"` // 损坏的数据块数
+	DamagedParity int      `json:"damagedParity"` // 损坏的恢复块数
+	Repairable    bool     `json:"repairable"`    // 每组损坏的块数都不超过该组的恢复块数
+	Repaired      bool     `json:"repaired"`      // 已修复并通过整个交付包的校验和
+	Problems      []string `json:"problems"`
+}
+
+// RestoreResult 是还原 (RestoreFiles) 完成后返回给前端的聚合数据
+type RestoreResult struct {
+	RestoredCount int      `json:"restoredCount"` // 成功还原的文件数
+	DirCount      int      `json:"dirCount"`      // 还原的目录数（包括空目录）
+	TotalSize     int64    `json:"totalSize"`     // 还原的数据量 (字节)
+	Errors        []string `json:"errors"`        // 还原失败的文件、目录及原因
+
+	Integrity *IntegrityReport `json:"integrity"` // 清单签名与清单链的校验结果
 }
@@ -0,0 +1,20 @@
+package verifier
+
+import "errors"
+
+var (
+	// ErrArchiveUnreadable 交付包无法读取
+	ErrArchiveUnreadable = errors.New("交付包无法读取")
+
+	// ErrEntryMissing 交付包中缺少条目
+	ErrEntryMissing = errors.New("交付包中缺少条目")
+
+	// ErrUnexpectedEntry 交付包中有多余的条目
+	ErrUnexpectedEntry = errors.New("交付包中有多余的条目")
+
+	// ErrArchiveChecksumMismatch 交付包文件的校验和与记录不符
+	ErrArchiveChecksumMismatch = errors.New("交付包校验和与记录不符")
+
+	// ErrChecksumMismatch 条目内容校验失败
+	ErrChecksumMismatch = errors.New("条目内容校验失败")
+)
@@ -0,0 +1,232 @@
+package verifier
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"beanckup/backend/encryptor"
+	"beanckup/backend/packager"
+	"beanckup/backend/throttle"
+	"beanckup/backend/types"
+	"beanckup/backend/worker"
+)
+
+// Entry 交付包中预期的一个条目及其内容的大小与哈希
+type Entry struct {
+	Name string
+	Size int64
+	Hash string
+}
+
+// Manager 校验器：重新打开交付包，核对条目列表并重新计算条目内容的哈希
+type Manager struct {
+	packager    *packager.Manager
+	readLimiter *throttle.Limiter
+}
+
+// NewManager 创建新的校验器
+func NewManager() *Manager {
+	return &Manager{
+		packager: packager.NewManager(),
+	}
+}
+
+// SetReadLimiter 设置读取限速器，校验读取交付包时受其约束
+func (m *Manager) SetReadLimiter(limiter *throttle.Limiter) {
+	m.readLimiter = limiter
+}
+
+// VerifyArchive 校验交付包：列出条目，确认预期的条目都存在且没有多余的条目，
+// 再解压条目并比对大小与哈希（7z 交付包只解压一遍，按条目大小切分内容流）；发现的问题记录在结果中
+func (m *Manager) VerifyArchive(packagePath string, expected []Entry, keys *encryptor.Keyring) *types.ArchiveVerification {
+	return m.verify(packagePath, expected, keys, true)
+}
+
+// VerifyEntries 校验交付包中的指定条目，允许存在其他条目（例如清单中已不再引用的旧版本）
+// expected 为空时只检查交付包能否打开并列出条目
+func (m *Manager) VerifyEntries(packagePath string, expected []Entry, keys *encryptor.Keyring) *types.ArchiveVerification {
+	return m.verify(packagePath, expected, keys, false)
+}
+
+// verify 校验交付包，strict 为 true 时多余的条目也视为问题；keys 提供加密交付包的密码
+func (m *Manager) verify(packagePath string, expected []Entry, keys *encryptor.Keyring, strict bool) *types.ArchiveVerification {
+	result := &types.ArchiveVerification{PackagePath: packagePath, Problems: []string{}}
+
+	var names []string
+	var check func(entry Entry) error
+	if strings.HasSuffix(packagePath, ".7z") {
+		password := keys.Password()
+		defer clear(password)
+		entries, err := m.packager.ListEntriesWith7zr(packagePath, password)
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("%v: %v", ErrArchiveUnreadable, err))
+			return result
+		}
+		for _, entry := range entries {
+			names = append(names, entry.Name)
+		}
+		var checked map[string]error
+		check = func(entry Entry) error {
+			if checked == nil {
+				checked = m.check7zEntries(packagePath, entries, expected, password)
+			}
+			return checked[entry.Name]
+		}
+	} else {
+		archive, err := packager.OpenZipArchive(packagePath, keys)
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("%v: %v", ErrArchiveUnreadable, err))
+			return result
+		}
+		defer archive.Close()
+		files := make(map[string]*zip.File, len(archive.File))
+		for _, f := range archive.File {
+			if strings.HasSuffix(f.Name, "/") {
+				continue
+			}
+			files[f.Name] = f
+			names = append(names, f.Name)
+		}
+		check = func(entry Entry) error {
+			r, err := files[entry.Name].Open()
+			if err != nil {
+				return fmt.Errorf("%w: %s: %v", ErrArchiveUnreadable, entry.Name, err)
+			}
+			return m.checkEntry(r, entry)
+		}
+	}
+	result.EntryCount = len(names)
+
+	present := make(map[string]bool, len(names))
+	for _, name := range names {
+		present[name] = true
+	}
+	wanted := make(map[string]bool, len(expected))
+	for _, entry := range expected {
+		wanted[entry.Name] = true
+		if !present[entry.Name] {
+			result.Problems = append(result.Problems, fmt.Sprintf("%v: %s", ErrEntryMissing, entry.Name))
+			continue
+		}
+		if err := check(entry); err != nil {
+			result.Problems = append(result.Problems, err.Error())
+			continue
+		}
+		result.CheckedCount++
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strict && !wanted[name] {
+			result.Problems = append(result.Problems, fmt.Sprintf("%v: %s", ErrUnexpectedEntry, name))
+		}
+	}
+
+	if len(result.Problems) > 0 {
+		log.Printf("Verifier: %s failed verification with %d problems.", packagePath, len(result.Problems))
+	}
+	return result
+}
+
+// Checksum 计算交付包文件的 SHA-256
+func (m *Manager) Checksum(packagePath string) (string, error) {
+	f, err := os.Open(packagePath)
+	if err != nil {
+		return "", fmt.Errorf("打开交付包失败: %w", err)
+	}
+	defer f.Close()
+
+	hasher := worker.NewHashingReader(throttle.Reader(f, m.readLimiter))
+	if _, err := io.Copy(io.Discard, hasher); err != nil {
+		return "", fmt.Errorf("计算交付包校验和失败: %w", err)
+	}
+	return hasher.Sum(), nil
+}
+
+// VerifyChecksum 比对交付包文件的 SHA-256 与记录的校验和，不解压条目
+func (m *Manager) VerifyChecksum(packagePath, checksum string) *types.ArchiveVerification {
+	result := &types.ArchiveVerification{PackagePath: packagePath, Problems: []string{}}
+	sum, err := m.Checksum(packagePath)
+	if err != nil {
+		result.Problems = append(result.Problems, fmt.Sprintf("%v: %v", ErrArchiveUnreadable, err))
+	} else if sum != checksum {
+		result.Problems = append(result.Problems, fmt.Sprintf("%v: %s", ErrArchiveChecksumMismatch, filepath.Base(packagePath)))
+	}
+	return result
+}
+
+// check7zEntries 用一次 7zr 解压得到全部条目首尾相接的内容流，按列出的大小切分后比对预期的条目，
+// 返回每个预期条目的比对结果；解压中途失败时，尚未比对完成的条目都记为无法读取
+func (m *Manager) check7zEntries(packagePath string, entries []packager.ArchiveEntry, expected []Entry, password []byte) map[string]error {
+	wanted := make(map[string]Entry, len(expected))
+	for _, entry := range expected {
+		wanted[entry.Name] = entry
+	}
+	checked := make(map[string]error, len(expected))
+	fail := func(err error) map[string]error {
+		for name := range wanted {
+			if _, ok := checked[name]; !ok {
+				checked[name] = fmt.Errorf("%w: %s: %v", ErrArchiveUnreadable, name, err)
+			}
+		}
+		return checked
+	}
+
+	stream, err := m.packager.ExtractAllWith7zr(packagePath, password)
+	if err != nil {
+		return fail(err)
+	}
+	for _, archived := range entries {
+		entry, ok := wanted[archived.Name]
+		if !ok {
+			if _, err := io.CopyN(io.Discard, stream, archived.Size); err != nil {
+				stream.Close()
+				return fail(err)
+			}
+			continue
+		}
+		hasher := worker.NewHashingReader(throttle.Reader(io.LimitReader(stream, archived.Size), m.readLimiter))
+		if _, err := io.Copy(io.Discard, hasher); err != nil {
+			stream.Close()
+			return fail(err)
+		}
+		if hasher.Size() != archived.Size {
+			stream.Close()
+			return fail(io.ErrUnexpectedEOF)
+		}
+		checked[entry.Name] = compare(hasher, entry)
+	}
+	if err := stream.Close(); err != nil {
+		// 7zr 报告错误时（例如 CRC 校验失败）无法确定哪些条目的内容可信，全部记为无法读取
+		clear(checked)
+		return fail(err)
+	}
+	return checked
+}
+
+// checkEntry 读取一个条目的内容并比对其大小与哈希
+func (m *Manager) checkEntry(r io.ReadCloser, entry Entry) error {
+	hasher := worker.NewHashingReader(throttle.Reader(r, m.readLimiter))
+	_, copyErr := io.Copy(io.Discard, hasher)
+	closeErr := r.Close()
+	if copyErr != nil {
+		return fmt.Errorf("%w: %s: %v", ErrArchiveUnreadable, entry.Name, copyErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("%w: %s: %v", ErrArchiveUnreadable, entry.Name, closeErr)
+	}
+	return compare(hasher, entry)
+}
+
+// compare 比对已读完的条目内容与预期的大小与哈希
+func compare(hasher *worker.HashingReader, entry Entry) error {
+	if hasher.Size() != entry.Size || (entry.Hash != "" && hasher.Sum() != entry.Hash) {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, entry.Name)
+	}
+	return nil
+}
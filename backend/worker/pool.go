@@ -0,0 +1,181 @@
+package worker
+
+import (
+	"beanckup/backend/throttle"
+	"beanckup/backend/types"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// defaultWorkerCount 未指定规模时的工作协程数，保守起步，由资源管理器按实际吞吐扩容
+	defaultWorkerCount = 2
+
+	// maxRecordedDecisions PoolStatus 中保留的最近调整决策数
+	maxRecordedDecisions = 20
+)
+
+// Pool 可在运行中调整规模的工作池
+type Pool struct {
+	mu        sync.Mutex
+	jobs      chan func()
+	workers   []chan struct{} // 每个工作协程的退出信号
+	isRunning bool
+	decisions []types.ScalingDecision
+
+	activeWorkers  int32
+	processedTasks int64
+	totalTasks     int64
+}
+
+// NewPool 创建一个新的工作池
+func NewPool() *Pool {
+	return &Pool{}
+}
+
+// Start 启动工作池
+func (p *Pool) Start(workerCount int) error {
+	if workerCount <= 0 {
+		return ErrInvalidWorkerCount
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.isRunning {
+		return ErrPoolAlreadyRunning
+	}
+
+	p.jobs = make(chan func(), 1024)
+	p.workers = nil
+	p.decisions = nil
+	atomic.StoreInt64(&p.processedTasks, 0)
+	atomic.StoreInt64(&p.totalTasks, 0)
+	p.isRunning = true
+	p.resizeLocked(workerCount)
+	return nil
+}
+
+// Stop 停止工作池，正在执行的任务会先完成
+func (p *Pool) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.isRunning {
+		return ErrPoolNotRunning
+	}
+
+	p.resizeLocked(0)
+	close(p.jobs)
+	p.isRunning = false
+	return nil
+}
+
+// Resize 调整工作协程数量；缩容时被移除的协程会先完成手头的任务
+func (p *Pool) Resize(workerCount int) error {
+	if workerCount <= 0 {
+		return ErrInvalidWorkerCount
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.isRunning {
+		return ErrPoolNotRunning
+	}
+	p.resizeLocked(workerCount)
+	return nil
+}
+
+// resizeLocked 在持有锁的情况下调整工作协程数量
+func (p *Pool) resizeLocked(workerCount int) {
+	for len(p.workers) < workerCount {
+		quit := make(chan struct{})
+		p.workers = append(p.workers, quit)
+		go p.run(quit)
+	}
+	for len(p.workers) > workerCount {
+		last := len(p.workers) - 1
+		close(p.workers[last])
+		p.workers = p.workers[:last]
+	}
+}
+
+// run 工作协程主循环
+// 后台模式切换时由新的协程接替，本协程退出（已降低优先级的线程随之销毁，见 throttle.EnterThread）
+func (p *Pool) run(quit <-chan struct{}) {
+	thread := throttle.EnterThread()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-thread.Changed():
+			go p.run(quit)
+			return
+		case job, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			atomic.AddInt32(&p.activeWorkers, 1)
+			job()
+			atomic.AddInt32(&p.activeWorkers, -1)
+			atomic.AddInt64(&p.processedTasks, 1)
+		}
+	}
+}
+
+// Submit 提交一个任务，队列满时阻塞等待
+func (p *Pool) Submit(job func()) error {
+	p.mu.Lock()
+	if !p.isRunning {
+		p.mu.Unlock()
+		return ErrPoolNotRunning
+	}
+	jobs := p.jobs
+	p.mu.Unlock()
+
+	atomic.AddInt64(&p.totalTasks, 1)
+	jobs <- job
+	return nil
+}
+
+// WorkerCount 返回当前工作协程数量
+func (p *Pool) WorkerCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.workers)
+}
+
+// RecordDecision 记录一次规模调整决策，供 GetStatus 展示
+func (p *Pool) RecordDecision(decision types.ScalingDecision) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.decisions = append(p.decisions, decision)
+	if len(p.decisions) > maxRecordedDecisions {
+		p.decisions = p.decisions[len(p.decisions)-maxRecordedDecisions:]
+	}
+}
+
+// GetStatus 获取工作池状态
+func (p *Pool) GetStatus() PoolStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	processed := int(atomic.LoadInt64(&p.processedTasks))
+	total := int(atomic.LoadInt64(&p.totalTasks))
+	progress := 0.0
+	if total > 0 {
+		progress = float64(processed) / float64(total)
+	}
+
+	status := PoolStatus{
+		IsRunning:      p.isRunning,
+		WorkerCount:    len(p.workers),
+		ActiveWorkers:  int(atomic.LoadInt32(&p.activeWorkers)),
+		ProcessedTasks: processed,
+		TotalTasks:     total,
+		Progress:       progress,
+		Decisions:      append([]types.ScalingDecision(nil), p.decisions...),
+	}
+	if p.jobs != nil {
+		status.QueueSize = len(p.jobs)
+	}
+	return status
+}
@@ -1,13 +1,15 @@
 package worker
 
 import (
+	"beanckup/backend/throttle"
 	"beanckup/backend/types"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"os"
-	"runtime"
+	"sort"
 	"sync"
 )
 
@@ -19,8 +21,11 @@ type WorkerPool interface {
 	// 停止工作池
 	Stop() error
 
+	// 调整工作协程数量
+	Resize(workerCount int) error
+
 	// 提交任务
-	SubmitTask(task types.TaskUnit) error
+	Submit(job func()) error
 
 	// 获取工作池状态
 	GetStatus() PoolStatus
@@ -35,6 +40,9 @@ type PoolStatus struct {
 	ProcessedTasks int     `json:"processed_tasks"`
 	TotalTasks     int     `json:"total_tasks"`
 	Progress       float64 `json:"progress"`
+
+	// 资源管理器最近的规模调整决策
+	Decisions []types.ScalingDecision `json:"decisions"`
 }
 
 // Worker 工作协程接口
@@ -45,7 +53,9 @@ type Worker interface {
 
 // Manager 工作协程管理器
 type Manager struct {
-	mu sync.Mutex
+	mu          sync.Mutex
+	readLimiter *throttle.Limiter
+	pool        *Pool
 }
 
 // TaskResult 任务结果
@@ -58,7 +68,19 @@ type TaskResult struct {
 
 // NewManager 创建新的工作池
 func NewManager() *Manager {
-	return &Manager{}
+	return &Manager{
+		pool: NewPool(),
+	}
+}
+
+// Pool 返回哈希计算使用的工作池，供资源管理器在运行中调整规模
+func (m *Manager) Pool() *Pool {
+	return m.pool
+}
+
+// SetReadLimiter 设置读取限速器，nil 表示不限速
+func (m *Manager) SetReadLimiter(limiter *throttle.Limiter) {
+	m.readLimiter = limiter
 }
 
 // WorkerResult 工作池结果
@@ -72,10 +94,7 @@ type WorkerResult struct {
 // StartWorkerPool 启动工作池，专注哈希计算
 func (m *Manager) StartWorkerPool(suspectFiles map[string]*types.FileInfo, numWorkers int, previousManifest *types.Manifest) (*WorkerResult, error) {
 	if numWorkers <= 0 {
-		numWorkers = runtime.NumCPU() * 2
-		if numWorkers > 16 {
-			numWorkers = 16
-		}
+		numWorkers = defaultWorkerCount
 	}
 
 	if len(suspectFiles) == 0 {
@@ -187,6 +206,134 @@ func (m *Manager) worker(taskChan <-chan *types.FileInfo, resultChan chan<- *Has
 	}
 }
 
+// HashTasks 在工作池中并发计算处理任务的哈希值
+// 小文件任务直接使用 file_processor 已读入内存的 Data，大文件任务从磁盘流式读取，
+// isKnown 判断某个哈希的内容是否已经备份过，命中或与本批次中更早的文件重复时标记为重复；
+// 工作池未启动时以默认规模临时启动
+func (m *Manager) HashTasks(tasks []*types.ProcessingTask, isKnown func(hash string) bool) []*types.WorkerResult {
+	if err := m.pool.Start(defaultWorkerCount); err == nil {
+		defer m.pool.Stop()
+	}
+
+	resultChan := make(chan *types.WorkerResult, len(tasks))
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		task := task
+		wg.Add(1)
+		err := m.pool.Submit(func() {
+			defer wg.Done()
+			contentHash, err := m.calculateTaskHash(task)
+			if err != nil {
+				err = fmt.Errorf("计算哈希失败 %s: %w", task.FileInfo.Path, err)
+			}
+			resultChan <- &types.WorkerResult{Task: task, ContentHash: contentHash, Error: err}
+		})
+		if err != nil {
+			wg.Done()
+			resultChan <- &types.WorkerResult{Task: task, Error: err}
+		}
+	}
+	wg.Wait()
+	close(resultChan)
+
+	results := make([]*types.WorkerResult, 0, len(tasks))
+	for result := range resultChan {
+		results = append(results, result)
+	}
+
+	// 按路径排序，保证同一批次内的重复判定与打包顺序是确定的
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Task.FileInfo.Path < results[j].Task.FileInfo.Path
+	})
+
+	seen := make(map[string]bool)
+	for _, result := range results {
+		if result.Error != nil {
+			continue
+		}
+		result.Task.FileInfo.ContentHash = result.ContentHash
+		if isKnown(result.ContentHash) || seen[result.ContentHash] {
+			result.IsDuplicate = true
+		}
+		seen[result.ContentHash] = true
+	}
+
+	return results
+}
+
+// PartitionBySize 按文件大小预筛选去重候选
+// 已在内存中的任务以及与已知内容或同批其他文件大小相同的大文件需要先计算哈希再决定是否打包；
+// 其余大文件不可能与任何已知内容重复，直接交给打包器边读边算哈希，只读取一次
+func (m *Manager) PartitionBySize(tasks []*types.ProcessingTask, knownSizes map[int64]bool) (toHash, toStream []*types.ProcessingTask) {
+	sizeCount := make(map[int64]int, len(tasks))
+	for _, task := range tasks {
+		sizeCount[task.FileInfo.Size]++
+	}
+
+	for _, task := range tasks {
+		size := task.FileInfo.Size
+		inMemory := task.Type == types.TaskTypeSmallFile && task.Data != nil
+		if inMemory || knownSizes[size] || sizeCount[size] > 1 {
+			toHash = append(toHash, task)
+		} else {
+			toStream = append(toStream, task)
+		}
+	}
+	return toHash, toStream
+}
+
+// HashingReader 在读取数据的同时计算 SHA-256，使打包与哈希共用同一次读取
+type HashingReader struct {
+	reader io.Reader
+	hash   hash.Hash
+	size   int64
+}
+
+// NewHashingReader 包装一个读取流，读取的数据同时写入哈希计算器
+func NewHashingReader(r io.Reader) *HashingReader {
+	return &HashingReader{
+		reader: r,
+		hash:   sha256.New(),
+	}
+}
+
+// Read 实现 io.Reader
+func (r *HashingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hash.Write(p[:n])
+	r.size += int64(n)
+	return n, err
+}
+
+// Continue 切换到新的读取流并保留已累积的哈希状态，用于分段读取同一个文件
+func (r *HashingReader) Continue(next io.Reader) {
+	r.reader = next
+}
+
+// Size 返回已读取的字节数
+func (r *HashingReader) Size() int64 {
+	return r.size
+}
+
+// Sum 返回已读取数据的十六进制哈希值，应在读取完毕后调用
+func (r *HashingReader) Sum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
+
+// calculateTaskHash 计算单个处理任务的哈希，优先使用内存中的数据
+func (m *Manager) calculateTaskHash(task *types.ProcessingTask) (string, error) {
+	if task.Type == types.TaskTypeSmallFile && task.Data != nil {
+		sum := sha256.Sum256(task.Data)
+		return hex.EncodeToString(sum[:]), nil
+	}
+
+	path := task.Path
+	if path == "" {
+		path = task.FileInfo.Path
+	}
+	return m.calculateFileHash(path)
+}
+
 // calculateFileHash 计算文件哈希
 func (m *Manager) calculateFileHash(filePath string) (string, error) {
 	hash := sha256.New()
@@ -198,9 +345,10 @@ func (m *Manager) calculateFileHash(filePath string) (string, error) {
 	defer file.Close()
 
 	// 流式读取并计算哈希
+	reader := throttle.Reader(file, m.readLimiter)
 	buffer := make([]byte, 64*1024) // 64KB缓冲区
 	for {
-		n, err := file.Read(buffer)
+		n, err := reader.Read(buffer)
 		if n > 0 {
 			hash.Write(buffer[:n])
 		}
@@ -215,19 +363,3 @@ func (m *Manager) calculateFileHash(filePath string) (string, error) {
 	// 返回十六进制哈希值
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
-
-// GetOptimalWorkerCount 获取最优工作协程数
-func (m *Manager) GetOptimalWorkerCount() int {
-	cpuCount := runtime.NumCPU()
-	workerCount := cpuCount * 2
-
-	if workerCount > 16 {
-		workerCount = 16
-	}
-
-	if workerCount < 2 {
-		workerCount = 2
-	}
-
-	return workerCount
-}
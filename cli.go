@@ -0,0 +1,248 @@
+package main
+
+import (
+	"beanckup/backend/task_manager"
+	"beanckup/backend/types"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// cliCommands 支持以命令行方式运行的子命令
+var cliCommands = map[string]func(args []string) int{
+	"scrub":           runScrub,
+	"parity-verify":   runParityVerify,
+	"parity-repair":   runParityRepair,
+	"rotate-keys":     runRotateKeys,
+	"keygen":          runKeygen,
+	"manifest-export": runManifestExport,
+}
+
+// runCLI 执行子命令并返回进程退出码
+func runCLI(command string, args []string) int {
+	return cliCommands[command](args)
+}
+
+// keySourceFlags 可重复的密钥来源参数
+type keySourceFlags struct {
+	keyfiles, recipients, identities []string
+}
+
+// register 注册 -keyfile 与 -identity 参数，sealing 为 true 时还注册用于加密的 -recipient 参数
+func (k *keySourceFlags) register(flags *flag.FlagSet, sealing bool) {
+	flags.Func("keyfile", "密钥文件路径（可重复）", func(value string) error {
+		k.keyfiles = append(k.keyfiles, value)
+		return nil
+	})
+	flags.Func("identity", "用于解密的 X25519 私钥文件路径（可重复）", func(value string) error {
+		k.identities = append(k.identities, value)
+		return nil
+	})
+	if sealing {
+		flags.Func("recipient", "用于加密的 X25519 接收者公钥（可重复）", func(value string) error {
+			k.recipients = append(k.recipients, value)
+			return nil
+		})
+	}
+}
+
+// newManager 创建任务管理器并设置密钥来源
+func (k *keySourceFlags) newManager() (*task_manager.Manager, error) {
+	manager := task_manager.NewManager()
+	if err := manager.SetKeySources(k.keyfiles, k.recipients, k.identities); err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+// runScrub 校验交付路径中的全部交付包，将报告以 JSON 输出到标准输出
+// 用法: beanckup scrub [-deep] [-trusted-key 公钥] [-keyfile 路径] [-identity 路径] <交付路径>；加密交付包的密码通过环境变量 BEANCKUP_PASSWORD 提供
+// 退出码：0 全部通过，1 发现缺失、损坏或未被引用的交付包，或清单签名与清单链有问题（包括未提供受信任的签名公钥），2 参数错误或无法完成校验
+func runScrub(args []string) int {
+	flags := flag.NewFlagSet("scrub", flag.ContinueOnError)
+	deep := flags.Bool("deep", false, "解压并重新计算全部条目的哈希（默认只比对交付包的校验和）")
+	trustedKey := flags.String("trusted-key", "", "受信任的签名公钥 beanckup-sig-...，清单与清单链必须由它签署")
+	var keys keySourceFlags
+	keys.register(flags, false)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "用法: beanckup scrub [-deep] [-trusted-key 公钥] [-keyfile 路径] [-identity 路径] <交付路径>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	manager, err := keys.newManager()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "加载密钥失败:", err)
+		return 2
+	}
+	report, err := manager.ScrubDelivery(flags.Arg(0), *deep, os.Getenv("BEANCKUP_PASSWORD"), *trustedKey, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "校验失败:", err)
+		return 2
+	}
+	data, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(data))
+	if len(report.Missing) > 0 || len(report.Corrupt) > 0 || len(report.Orphaned) > 0 || len(report.Integrity.Problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runParityVerify 按恢复数据校验交付路径中的交付包，将结果以 JSON 输出到标准输出
+// 用法: beanckup parity-verify <交付路径>；退出码：0 全部完好，1 发现损坏，2 参数错误或无法完成校验
+func runParityVerify(args []string) int {
+	return runParity("parity-verify", args, false)
+}
+
+// runParityRepair 按恢复数据修复交付路径中损坏的交付包，将结果以 JSON 输出到标准输出
+// 用法: beanckup parity-repair <交付路径>；退出码：0 全部完好或已修复，1 存在无法修复的交付包，2 参数错误或无法完成修复
+func runParityRepair(args []string) int {
+	return runParity("parity-repair", args, true)
+}
+
+// runParity 执行恢复数据的校验或修复
+func runParity(name string, args []string, repair bool) int {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "用法: beanckup %s <交付路径>\n", name)
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	manager := task_manager.NewManager()
+	var reports []*types.ParityReport
+	var err error
+	if repair {
+		reports, err = manager.RepairDelivery(flags.Arg(0), nil)
+	} else {
+		reports, err = manager.VerifyParity(flags.Arg(0), nil)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "操作失败:", err)
+		return 2
+	}
+	data, _ := json.MarshalIndent(reports, "", "  ")
+	fmt.Println(string(data))
+	for _, report := range reports {
+		damaged := report.DamagedBlocks > 0 || report.DamagedParity > 0 || len(report.Problems) > 0
+		if damaged && !(repair && (report.Repaired || report.DamagedBlocks == 0)) {
+			return 1
+		}
+	}
+	return 0
+}
+
+// runRotateKeys 轮换交付路径中原生加密的交付包与清单的密钥，将报告以 JSON 输出到标准输出
+// 用法: beanckup rotate-keys [-keyfile 路径] [-identity 路径] [-recipient 公钥] <交付路径>
+// 旧密码通过环境变量 BEANCKUP_PASSWORD 提供，新密码通过 BEANCKUP_NEW_PASSWORD 提供（为空时轮换后不再使用密码）
+// 退出码：0 全部轮换，1 部分交付包轮换失败，2 参数错误或无法完成轮换
+func runRotateKeys(args []string) int {
+	flags := flag.NewFlagSet("rotate-keys", flag.ContinueOnError)
+	var keys keySourceFlags
+	keys.register(flags, true)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "用法: beanckup rotate-keys [-keyfile 路径] [-identity 路径] [-recipient 公钥] <交付路径>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	manager, err := keys.newManager()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "加载密钥失败:", err)
+		return 2
+	}
+	report, err := manager.RotateKeys(flags.Arg(0), os.Getenv("BEANCKUP_PASSWORD"), os.Getenv("BEANCKUP_NEW_PASSWORD"), nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "轮换失败:", err)
+		return 2
+	}
+	data, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(data))
+	if len(report.Failed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runKeygen 生成新的 X25519 私钥文件并输出对应的公钥，指定 -keyfile 时生成密钥文件并输出其密钥标识
+// 用法: beanckup keygen [-keyfile] <路径>；退出码：0 成功，2 参数错误或生成失败
+func runKeygen(args []string) int {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	keyfile := flags.Bool("keyfile", false, "生成密钥文件而不是 X25519 私钥")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "用法: beanckup keygen [-keyfile] <路径>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	manager := task_manager.NewManager()
+	var output string
+	var err error
+	if *keyfile {
+		output, err = manager.GenerateKeyfile(flags.Arg(0))
+	} else {
+		output, err = manager.GenerateIdentity(flags.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "生成失败:", err)
+		return 2
+	}
+	fmt.Println(output)
+	return 0
+}
+
+// runManifestExport 将工作区或交付路径中的清单导出为缩进的 JSON，输出到标准输出，用于调试
+// 用法: beanckup manifest-export [-delivery] [-keyfile 路径] [-identity 路径] <路径>；加密清单的密码通过环境变量 BEANCKUP_PASSWORD 提供
+// 退出码：0 成功，2 参数错误或无法读取清单
+func runManifestExport(args []string) int {
+	flags := flag.NewFlagSet("manifest-export", flag.ContinueOnError)
+	delivery := flags.Bool("delivery", false, "路径为交付路径（默认为工作区）")
+	var keys keySourceFlags
+	keys.register(flags, false)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "用法: beanckup manifest-export [-delivery] [-keyfile 路径] [-identity 路径] <路径>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	manager, err := keys.newManager()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "加载密钥失败:", err)
+		return 2
+	}
+	if err := manager.ExportManifest(flags.Arg(0), *delivery, os.Getenv("BEANCKUP_PASSWORD"), os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "导出失败:", err)
+		return 2
+	}
+	return 0
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"beanckup/backend/indexer"
 	"beanckup/backend/task_manager"
+	"beanckup/backend/worker"
 	"context"
 	"embed"
 	"log"
@@ -65,7 +66,7 @@ func (a *App) ScanWorkspace(path string) (interface{}, error) {
 	}
 
 	// 执行扫描
-	_, err := indexer.ScanWorkspace(path, progressCallback)
+	_, _, err := indexer.ScanWorkspace(path, progressCallback)
 	if err != nil {
 		log.Printf("Error during workspace scan: %v", err)
 		return nil, err
@@ -80,17 +81,194 @@ func (a *App) ScanWorkspace(path string) (interface{}, error) {
 
 // StartBackupPreparation 接收备份参数，进行预处理
 // 这是一个重量级操作，对应"首次扫描"
-func (a *App) StartBackupPreparation(workspacePath string, maxPackageSizeGB, maxTotalSizeGB float64) (*types.BackupPreparationResult, error) {
+func (a *App) StartBackupPreparation(workspacePath string, maxPackageSizeGB, maxTotalSizeGB float64, selectionPolicy string, priorityFolders []string) (*types.BackupPreparationResult, error) {
 	log.Printf("Frontend called: StartBackupPreparation with workspace: %s\n", workspacePath)
-	return a.taskManager.StartBackupPreparation(workspacePath, maxPackageSizeGB, maxTotalSizeGB)
+	return a.taskManager.StartBackupPreparation(workspacePath, maxPackageSizeGB, maxTotalSizeGB, types.SelectionPolicy(selectionPolicy), priorityFolders)
 }
 
-// StartBackupExecution 启动实际的备份流程
-func (a *App) StartBackupExecution(workspacePath, deliveryPath string, maxPackageSizeGB, maxTotalSizeGB float64, password string) (interface{}, error) {
-	log.Printf("Frontend called: StartBackupExecution with workspace: %s, deliveryPath: %s\n", workspacePath, deliveryPath)
-	// TODO: 调用重构后的 task_manager 模块
-	// 暂时返回空数据
-	return nil, nil
+// StartBackupExecution 按预处理生成的备份计划启动实际的备份流程
+func (a *App) StartBackupExecution(workspacePath, deliveryPath, planID, password string) (*types.BackupExecutionResult, error) {
+	log.Printf("Frontend called: StartBackupExecution with workspace: %s, deliveryPath: %s, plan: %s\n", workspacePath, deliveryPath, planID)
+	return a.taskManager.StartBackupExecution(workspacePath, deliveryPath, planID, password, a.ctx)
+}
+
+// ExcludePlanPath 将文件或目录排除在备份计划之外
+func (a *App) ExcludePlanPath(workspacePath, planID, path string) (*types.BackupPreparationResult, error) {
+	log.Printf("Frontend called: ExcludePlanPath %s in plan %s\n", path, planID)
+	return a.taskManager.ExcludePlanPath(workspacePath, planID, path)
+}
+
+// IncludePlanPath 将文件或目录重新纳入备份计划
+func (a *App) IncludePlanPath(workspacePath, planID, path string) (*types.BackupPreparationResult, error) {
+	log.Printf("Frontend called: IncludePlanPath %s in plan %s\n", path, planID)
+	return a.taskManager.IncludePlanPath(workspacePath, planID, path)
+}
+
+// AssignPlanPath 将文件或目录固定分配到指定分集
+func (a *App) AssignPlanPath(workspacePath, planID, path, episodeID string) (*types.BackupPreparationResult, error) {
+	log.Printf("Frontend called: AssignPlanPath %s to %s in plan %s\n", path, episodeID, planID)
+	return a.taskManager.AssignPlanPath(workspacePath, planID, path, episodeID)
+}
+
+// RebalancePlan 清除固定分配并重新规划分集
+func (a *App) RebalancePlan(workspacePath, planID string) (*types.BackupPreparationResult, error) {
+	log.Printf("Frontend called: RebalancePlan %s\n", planID)
+	return a.taskManager.RebalancePlan(workspacePath, planID)
+}
+
+// GetPoolStatus 获取工作池状态，包括自适应调整的决策记录
+func (a *App) GetPoolStatus() worker.PoolStatus {
+	return a.taskManager.GetPoolStatus()
+}
+
+// SetIOLimits 设置读写限速（MB/s，0 表示不限速），可在备份运行中随时调整
+func (a *App) SetIOLimits(readMBps, writeMBps float64) {
+	log.Printf("Frontend called: SetIOLimits with read: %.2f MB/s, write: %.2f MB/s\n", readMBps, writeMBps)
+	a.taskManager.SetIOLimits(int64(readMBps*1024*1024), int64(writeMBps*1024*1024))
+}
+
+// SetBackgroundMode 开启或关闭后台模式（降低 CPU 与 I/O 优先级），备份运行中切换时从下一个分集起生效
+func (a *App) SetBackgroundMode(enabled bool) error {
+	log.Printf("Frontend called: SetBackgroundMode with enabled: %v\n", enabled)
+	return a.taskManager.SetBackgroundMode(enabled)
+}
+
+// SetDeliveryVerification 设置打包后是否校验交付包，以及校验失败时是否重新打包
+func (a *App) SetDeliveryVerification(enabled, repackOnFailure bool) {
+	log.Printf("Frontend called: SetDeliveryVerification with enabled: %v, repack: %v\n", enabled, repackOnFailure)
+	a.taskManager.SetDeliveryVerification(enabled, repackOnFailure)
+}
+
+// SetMetadataPreservation 设置是否记录并在还原时恢复文件的权限、属主与扩展属性，下次预处理起生效
+func (a *App) SetMetadataPreservation(enabled bool) {
+	log.Printf("Frontend called: SetMetadataPreservation with enabled: %v\n", enabled)
+	a.taskManager.SetMetadataPreservation(enabled)
+}
+
+// SetEncryptionMode 设置提供密码时交付包的加密方式（native 或 7z）
+func (a *App) SetEncryptionMode(mode string) error {
+	log.Printf("Frontend called: SetEncryptionMode with %s\n", mode)
+	return a.taskManager.SetEncryptionMode(mode)
+}
+
+// SetKeySources 设置除密码外的密钥来源：密钥文件路径、X25519 接收者公钥与私钥文件路径
+func (a *App) SetKeySources(keyfiles, recipients, identities []string) error {
+	log.Printf("Frontend called: SetKeySources with %d keyfiles, %d recipients, %d identities\n", len(keyfiles), len(recipients), len(identities))
+	return a.taskManager.SetKeySources(keyfiles, recipients, identities)
+}
+
+// GenerateKeyfile 选择保存位置并生成新的密钥文件，返回文件路径，取消选择时返回空字符串
+func (a *App) GenerateKeyfile() (string, error) {
+	log.Println("Frontend called: GenerateKeyfile")
+	path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{Title: "保存密钥文件", DefaultFilename: "beanckup.key"})
+	if err != nil || path == "" {
+		return "", err
+	}
+	if _, err := a.taskManager.GenerateKeyfile(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// GenerateIdentity 选择保存位置并生成新的 X25519 私钥文件，返回文件路径与对应的公钥，取消选择时返回 nil
+func (a *App) GenerateIdentity() (map[string]string, error) {
+	log.Println("Frontend called: GenerateIdentity")
+	path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{Title: "保存私钥文件", DefaultFilename: "beanckup-identity.txt"})
+	if err != nil || path == "" {
+		return nil, err
+	}
+	publicKey, err := a.taskManager.GenerateIdentity(path)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"path": path, "publicKey": publicKey}, nil
+}
+
+// ChangePassword 修改工作区系列的密码，指定交付路径时一并轮换其中交付包的密钥
+func (a *App) ChangePassword(workspacePath, deliveryPath, oldPassword, newPassword string) (*types.KeyRotationReport, error) {
+	log.Printf("Frontend called: ChangePassword for %s (delivery: %s)\n", workspacePath, deliveryPath)
+	return a.taskManager.ChangePassword(workspacePath, deliveryPath, oldPassword, newPassword, a.ctx)
+}
+
+// RotateKeys 轮换交付路径中原生加密的交付包与清单的密钥
+func (a *App) RotateKeys(deliveryPath, oldPassword, newPassword string) (*types.KeyRotationReport, error) {
+	log.Printf("Frontend called: RotateKeys %s\n", deliveryPath)
+	return a.taskManager.RotateKeys(deliveryPath, oldPassword, newPassword, a.ctx)
+}
+
+// RestoreFiles 从交付路径还原文件到 targetPath，paths 为空时还原全部文件
+// trustedKey 为受信任的签名公钥，为空时签名者报告为未经确认
+func (a *App) RestoreFiles(deliveryPath, targetPath string, paths []string, password, trustedKey string) (*types.RestoreResult, error) {
+	log.Printf("Frontend called: RestoreFiles from %s to %s\n", deliveryPath, targetPath)
+	return a.taskManager.RestoreFiles(deliveryPath, targetPath, paths, password, trustedKey, a.ctx)
+}
+
+// ExportManifest 选择保存位置并将工作区或交付路径中的清单导出为 JSON，返回文件路径，取消选择时返回空字符串
+func (a *App) ExportManifest(path string, delivery bool, password string) (string, error) {
+	log.Printf("Frontend called: ExportManifest for %s (delivery: %v)\n", path, delivery)
+	target, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{Title: "导出清单", DefaultFilename: "manifest.json"})
+	if err != nil || target == "" {
+		return "", err
+	}
+	file, err := os.Create(target)
+	if err != nil {
+		return "", err
+	}
+	if err := a.taskManager.ExportManifest(path, delivery, password, file); err != nil {
+		file.Close()
+		os.Remove(target)
+		return "", err
+	}
+	return target, file.Close()
+}
+
+// ListSeries 返回工作区的系列登记，包括历次运行产生的全部分集及其状态
+func (a *App) ListSeries(workspacePath string) (*types.Series, error) {
+	log.Printf("Frontend called: ListSeries for %s\n", workspacePath)
+	return a.taskManager.ListSeries(workspacePath)
+}
+
+// UpdateEpisodeStatus 将已交付的分集标记为已归档或已清理
+func (a *App) UpdateEpisodeStatus(workspacePath, episodeID, status string) (*types.Episode, error) {
+	log.Printf("Frontend called: UpdateEpisodeStatus %s to %s\n", episodeID, status)
+	return a.taskManager.UpdateEpisodeStatus(workspacePath, episodeID, status)
+}
+
+// SetNamingTemplate 设置工作区的交付包命名模板，为空时恢复默认模板
+func (a *App) SetNamingTemplate(workspacePath, template string) error {
+	log.Printf("Frontend called: SetNamingTemplate %q for %s\n", template, workspacePath)
+	return a.taskManager.SetNamingTemplate(workspacePath, template)
+}
+
+// SigningPublicKey 返回工作区的签名公钥，前端将其作为校验交付路径时受信任的公钥
+func (a *App) SigningPublicKey(workspacePath string) (string, error) {
+	log.Printf("Frontend called: SigningPublicKey %s\n", workspacePath)
+	return a.taskManager.SigningPublicKey(workspacePath)
+}
+
+// ScrubDelivery 校验交付路径中的全部交付包，报告缺失、损坏或未被引用的交付包
+// trustedKey 为受信任的签名公钥，为空时签名者报告为未经确认
+func (a *App) ScrubDelivery(deliveryPath string, deep bool, password, trustedKey string) (*types.ScrubReport, error) {
+	log.Printf("Frontend called: ScrubDelivery %s (deep: %v)\n", deliveryPath, deep)
+	return a.taskManager.ScrubDelivery(deliveryPath, deep, password, trustedKey, a.ctx)
+}
+
+// SetParityRedundancy 设置为每个交付包生成的恢复数据冗余比例（百分比，0 表示不生成）
+func (a *App) SetParityRedundancy(percent int) error {
+	log.Printf("Frontend called: SetParityRedundancy with %d%%\n", percent)
+	return a.taskManager.SetParityRedundancy(percent)
+}
+
+// VerifyParity 按恢复数据校验交付路径中的交付包
+func (a *App) VerifyParity(deliveryPath string) ([]*types.ParityReport, error) {
+	log.Printf("Frontend called: VerifyParity %s\n", deliveryPath)
+	return a.taskManager.VerifyParity(deliveryPath, a.ctx)
+}
+
+// RepairDelivery 按恢复数据修复交付路径中损坏的交付包
+func (a *App) RepairDelivery(deliveryPath string) ([]*types.ParityReport, error) {
+	log.Printf("Frontend called: RepairDelivery %s\n", deliveryPath)
+	return a.taskManager.RepairDelivery(deliveryPath, a.ctx)
 }
 
 // CopyToClipboard 将文本复制到系统剪贴板
@@ -109,6 +287,13 @@ func main() {
 	log.SetOutput(logFile)
 	log.Println("Application starting...")
 
+	// 带子命令启动时以命令行方式运行，不打开窗口
+	if len(os.Args) > 1 && cliCommands[os.Args[1]] != nil {
+		code := runCLI(os.Args[1], os.Args[2:])
+		logFile.Close()
+		os.Exit(code)
+	}
+
 	app := NewApp()
 
 	err = wails.Run(&options.App{